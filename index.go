@@ -1,14 +1,31 @@
 package main
 import (
-    "fmt"   // Пакет для форматированного ввода-вывода (вывод результатов)
-    "math"  // Математические функции (корень, логарифм, модуль и т.д.)
-    "sort"  // Сортировка (используется в TInv для интерполяции)
+    "bufio"         // Построчное чтение файла праздничных дней
+    "context"       // Отмена пакетного расчета рядов
+    "encoding/csv"  // Выгрузка истории моделей скользящего окна в CSV
+    "encoding/json" // Сериализация модели в файл формата JSON
+    "errors"        // Ошибки HTTP-сервиса прогнозирования
+    "flag"          // Параметры командной строки (режим HTTP-сервиса)
+    "fmt"           // Пакет для форматированного ввода-вывода (вывод результатов)
+    "io"            // Запись истории моделей в произвольный поток
+    "log"           // Журнал HTTP-сервиса
+    "math"          // Математические функции (корень, логарифм, модуль и т.д.)
+    "math/rand"     // Генератор случайных чисел для бутстрепа
+    "net/http"      // HTTP-сервис прогнозирования
+    "os"            // Чтение и запись файлов модели и истории
+    "runtime"       // Число процессоров для пулов горутин
+    "sort"          // Сортировка (квантили, ансамбль, проекция на симплекс)
+    "strconv"       // Разбор списка лагов из командной строки
+    "strings"       // Разбор файла праздничных дней
+    "sync"          // Синхронизация HTTP-сервиса и пулов горутин
+    "time"          // Календарные признаки: день недели, месяц, праздники
 )
 // Matrix структура для работы с матрицами
 // Используется для хранения данных и выполнения матричных операций
 type Matrix struct {
-    Rows, Cols int      // Размеры матрицы: количество строк и столбцов
-    Data       []float64 // Элементы матрицы, хранящиеся в построчном порядке
+    Rows int       `json:"rows"` // Количество строк матрицы
+    Cols int       `json:"cols"` // Количество столбцов матрицы
+    Data []float64 `json:"data"` // Элементы матрицы, хранящиеся в построчном порядке
 }
 // NewMatrix создает новую матрицу с проверкой корректности размера данных
 // rows - количество строк, cols - количество столбцов
@@ -28,9 +45,364 @@ func (m Matrix) At(i, j int) float64 {
 func (m Matrix) Set(i, j int, value float64) {
     m.Data[i*m.Cols+j] = value
 }
+// Identity возвращает единичную матрицу размера n×n
+func Identity(n int) Matrix {
+    m := NewMatrix(n, n, make([]float64, n*n))
+    for i := 0; i < n; i++ {
+        m.Set(i, i, 1)
+    }
+    return m
+}
+
+// Row возвращает i-ю строку матрицы как представление:
+// срез разделяет память с матрицей, изменения видны в обоих
+func (m Matrix) Row(i int) []float64 {
+    return m.Data[i*m.Cols : (i+1)*m.Cols]
+}
+
+// Col возвращает копию j-го столбца матрицы
+func (m Matrix) Col(j int) []float64 {
+    col := make([]float64, m.Rows)
+    for i := 0; i < m.Rows; i++ {
+        col[i] = m.At(i, j)
+    }
+    return col
+}
+
+// RowsView возвращает строки [r0, r1) как представление без копирования
+func (m Matrix) RowsView(r0, r1 int) Matrix {
+    if r0 < 0 || r1 > m.Rows || r0 > r1 {
+        panic("Неверный диапазон строк матрицы")
+    }
+    return Matrix{Rows: r1 - r0, Cols: m.Cols, Data: m.Data[r0*m.Cols : r1*m.Cols : r1*m.Cols]}
+}
+
+// Slice возвращает копию подматрицы из строк [r0, r1) и столбцов [c0, c1)
+func (m Matrix) Slice(r0, r1, c0, c1 int) Matrix {
+    if r0 < 0 || r1 > m.Rows || r0 > r1 || c0 < 0 || c1 > m.Cols || c0 > c1 {
+        panic("Неверные границы подматрицы")
+    }
+    result := NewMatrix(r1-r0, c1-c0, make([]float64, (r1-r0)*(c1-c0)))
+    for i := r0; i < r1; i++ {
+        copy(result.Row(i-r0), m.Data[i*m.Cols+c0:i*m.Cols+c1])
+    }
+    return result
+}
+
+// Clone возвращает независимую копию матрицы
+func (m Matrix) Clone() Matrix {
+    data := make([]float64, len(m.Data))
+    copy(data, m.Data)
+    return NewMatrix(m.Rows, m.Cols, data)
+}
+
+// Equal сравнивает матрицы поэлементно с допуском tol
+func (m Matrix) Equal(b Matrix, tol float64) bool {
+    if m.Rows != b.Rows || m.Cols != b.Cols {
+        return false
+    }
+    for i, v := range m.Data {
+        if math.Abs(v-b.Data[i]) > tol {
+            return false
+        }
+    }
+    return true
+}
+
+// AppendRow возвращает новую матрицу с добавленной в конец строкой row
+func (m Matrix) AppendRow(row []float64) Matrix {
+    if len(row) != m.Cols {
+        panic("Неверная длина добавляемой строки")
+    }
+    data := make([]float64, 0, len(m.Data)+m.Cols)
+    data = append(append(data, m.Data...), row...)
+    return NewMatrix(m.Rows+1, m.Cols, data)
+}
+
+// DropRow возвращает новую матрицу без i-й строки
+func (m Matrix) DropRow(i int) Matrix {
+    if i < 0 || i >= m.Rows {
+        panic("Неверный номер удаляемой строки")
+    }
+    data := make([]float64, 0, len(m.Data)-m.Cols)
+    data = append(append(data, m.Data[:i*m.Cols]...), m.Data[(i+1)*m.Cols:]...)
+    return NewMatrix(m.Rows-1, m.Cols, data)
+}
+
+// HStack возвращает матрицу [A | B] из столбцов A и следующих за ними столбцов B
+func HStack(a, b Matrix) Matrix {
+    if a.Rows != b.Rows {
+        panic("Количество строк объединяемых матриц должно совпадать")
+    }
+    result := NewMatrix(a.Rows, a.Cols+b.Cols, make([]float64, a.Rows*(a.Cols+b.Cols)))
+    for i := 0; i < a.Rows; i++ {
+        copy(result.Row(i), a.Row(i))
+        copy(result.Row(i)[a.Cols:], b.Row(i))
+    }
+    return result
+}
+
+// Add возвращает поэлементную сумму матриц A + B
+func Add(a, b Matrix) Matrix {
+    result := a.Clone()
+    result.AddInPlace(b)
+    return result
+}
+
+// Sub возвращает поэлементную разность матриц A - B
+func Sub(a, b Matrix) Matrix {
+    result := a.Clone()
+    result.SubInPlace(b)
+    return result
+}
+
+// MulElem возвращает поэлементное произведение матриц (произведение Адамара)
+func MulElem(a, b Matrix) Matrix {
+    result := a.Clone()
+    result.MulElemInPlace(b)
+    return result
+}
+
+// Scale возвращает матрицу, умноженную на скаляр s
+func Scale(m Matrix, s float64) Matrix {
+    result := m.Clone()
+    result.ScaleInPlace(s)
+    return result
+}
+
+// AddScalar возвращает матрицу, к каждому элементу которой прибавлен скаляр s
+func AddScalar(m Matrix, s float64) Matrix {
+    result := m.Clone()
+    for i := range result.Data {
+        result.Data[i] += s
+    }
+    return result
+}
+
+// AddInPlace прибавляет B к матрице без выделения памяти
+func (m Matrix) AddInPlace(b Matrix) {
+    checkSameSize(m, b)
+    for i, v := range b.Data {
+        m.Data[i] += v
+    }
+}
+
+// SubInPlace вычитает B из матрицы без выделения памяти
+func (m Matrix) SubInPlace(b Matrix) {
+    checkSameSize(m, b)
+    for i, v := range b.Data {
+        m.Data[i] -= v
+    }
+}
+
+// MulElemInPlace поэлементно умножает матрицу на B без выделения памяти
+func (m Matrix) MulElemInPlace(b Matrix) {
+    checkSameSize(m, b)
+    for i, v := range b.Data {
+        m.Data[i] *= v
+    }
+}
+
+// ScaleInPlace умножает матрицу на скаляр s без выделения памяти
+func (m Matrix) ScaleInPlace(s float64) {
+    for i := range m.Data {
+        m.Data[i] *= s
+    }
+}
+
+// checkSameSize проверяет совпадение размеров матриц для поэлементных операций
+func checkSameSize(a, b Matrix) {
+    if a.Rows != b.Rows || a.Cols != b.Cols {
+        panic("Размеры матриц для поэлементной операции не совпадают")
+    }
+}
+
+// Dot возвращает скалярное произведение векторов a и b
+func Dot(a, b []float64) float64 {
+    if len(a) != len(b) {
+        panic("Размеры векторов должны совпадать")
+    }
+    sum := 0.0
+    for i, v := range a {
+        sum += v * b[i]
+    }
+    return sum
+}
+
+// QuadForm возвращает квадратичную форму xGxᵀ для вектора-строки x
+// (например, xᵢ(XᵀX)⁻¹xᵢᵀ в дисперсии прогноза)
+func QuadForm(x []float64, G Matrix) float64 {
+    if G.Rows != len(x) || G.Cols != len(x) {
+        panic("Несовместимые размеры вектора и матрицы квадратичной формы")
+    }
+    sum := 0.0
+    for j := range x {
+        for l := range x {
+            sum += x[j] * G.At(j, l) * x[l]
+        }
+    }
+    return sum
+}
+
+// RingMatrix - матрица фиксированной емкости на кольцевом буфере для скользящих окон.
+// Добавление строки в заполненное окно вытесняет самую старую без сдвига остальных
+type RingMatrix struct {
+    cols     int       // Количество столбцов
+    capacity int       // Максимальное число строк
+    start    int       // Индекс самой старой строки в буфере
+    count    int       // Текущее число строк
+    data     []float64 // Буфер capacity×cols в построчном порядке
+}
+
+// NewRingMatrix создает пустое окно емкостью capacity строк по cols столбцов
+func NewRingMatrix(capacity, cols int) *RingMatrix {
+    if capacity <= 0 || cols <= 0 {
+        panic("Неверный размер кольцевой матрицы")
+    }
+    return &RingMatrix{cols: cols, capacity: capacity, data: make([]float64, capacity*cols)}
+}
+
+// Len возвращает текущее число строк окна
+func (r *RingMatrix) Len() int {
+    return r.count
+}
+
+// Cap возвращает максимальное число строк окна
+func (r *RingMatrix) Cap() int {
+    return r.capacity
+}
+
+// Cols возвращает количество столбцов окна
+func (r *RingMatrix) Cols() int {
+    return r.cols
+}
+
+// Push добавляет строку в конец окна; если окно заполнено,
+// самая старая строка вытесняется (принцип FIFO)
+func (r *RingMatrix) Push(row []float64) {
+    if len(row) != r.cols {
+        panic("Неверная длина добавляемой строки")
+    }
+    pos := (r.start + r.count) % r.capacity
+    if r.count == r.capacity {
+        r.start = (r.start + 1) % r.capacity
+    } else {
+        r.count++
+    }
+    copy(r.data[pos*r.cols:(pos+1)*r.cols], row)
+}
+
+// DropOldest удаляет k самых старых строк окна
+func (r *RingMatrix) DropOldest(k int) {
+    if k < 0 || k > r.count {
+        panic("Неверное число удаляемых строк")
+    }
+    r.start = (r.start + k) % r.capacity
+    r.count -= k
+}
+
+// Row возвращает i-ю по давности строку (0 - самая старая) как представление
+func (r *RingMatrix) Row(i int) []float64 {
+    if i < 0 || i >= r.count {
+        panic("Неверный номер строки окна")
+    }
+    pos := (r.start + i) % r.capacity
+    return r.data[pos*r.cols : (pos+1)*r.cols]
+}
+
+// At возвращает элемент j i-й по давности строки
+func (r *RingMatrix) At(i, j int) float64 {
+    return r.Row(i)[j]
+}
+
+// Matrix возвращает содержимое окна как обычную матрицу (копия, от старых строк к новым)
+func (r *RingMatrix) Matrix() Matrix {
+    m := NewMatrix(r.count, r.cols, make([]float64, r.count*r.cols))
+    for i := 0; i < r.count; i++ {
+        copy(m.Row(i), r.Row(i))
+    }
+    return m
+}
+
+// Параметры ядра умножения матриц
+const (
+    multiplyBlockSize         = 64      // Размер блока строк/столбцов, помещающегося в кэш
+    multiplyParallelThreshold = 1 << 20 // Число умножений, начиная с которого ядро распараллеливается
+)
+
 // Multiply умножает две матрицы: A (m×n) * B (n×p) = C (m×p)
 // Требование: количество столбцов A должно равняться количеству строк B
+// B предварительно транспонируется, чтобы скалярные произведения шли по
+// непрерывным участкам памяти; вычисление идет блоками строк и столбцов,
+// а для больших матриц блоки строк распределяются между горутинами
 func Multiply(a, b Matrix) Matrix {
+    return multiplyWorkers(a, b, runtime.GOMAXPROCS(0))
+}
+
+// multiplyWorkers - Multiply, использующий не более workers горутин
+// (workers = 1 - последовательное блочное умножение)
+func multiplyWorkers(a, b Matrix, workers int) Matrix {
+    if a.Cols != b.Rows {
+        panic("Несовместимые размеры матриц для умножения")
+    }
+    result := NewMatrix(a.Rows, b.Cols, make([]float64, a.Rows*b.Cols))
+    bT := Transpose(b) // Строки bT - столбцы B
+
+    // Малые матрицы (в том числе 5×5 из Augment) считаются в текущей горутине
+    if a.Rows*a.Cols*b.Cols < multiplyParallelThreshold || a.Rows < 2*multiplyBlockSize || workers < 2 {
+        multiplyRows(a, bT, result, 0, a.Rows)
+        return result
+    }
+
+    // Параллельная обработка: каждая горутина берет очередной блок строк
+    blocks := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for r0 := range blocks {
+                multiplyRows(a, bT, result, r0, min(r0+multiplyBlockSize, a.Rows))
+            }
+        }()
+    }
+    for r0 := 0; r0 < a.Rows; r0 += multiplyBlockSize {
+        blocks <- r0
+    }
+    close(blocks)
+    wg.Wait()
+
+    return result
+}
+
+// multiplyRows вычисляет строки [r0, r1) произведения A * B по транспонированной bT.
+// Блоки столбцов bT перебираются так, чтобы они оставались в кэше для всех
+// строк блока A; порядок суммирования по k совпадает с классическим алгоритмом
+func multiplyRows(a, bT, result Matrix, r0, r1 int) {
+    n := a.Cols
+    for ii := r0; ii < r1; ii += multiplyBlockSize {
+        iEnd := min(ii+multiplyBlockSize, r1)
+        for jj := 0; jj < bT.Rows; jj += multiplyBlockSize {
+            jEnd := min(jj+multiplyBlockSize, bT.Rows)
+            for i := ii; i < iEnd; i++ {
+                aRow := a.Data[i*n : (i+1)*n]
+                resultRow := result.Data[i*result.Cols : (i+1)*result.Cols]
+                for j := jj; j < jEnd; j++ {
+                    bCol := bT.Data[j*n : (j+1)*n]
+                    sum := 0.0
+                    for k, v := range aRow {
+                        sum += v * bCol[k]
+                    }
+                    resultRow[j] = sum
+                }
+            }
+        }
+    }
+}
+
+// multiplyNaive - исходный алгоритм умножения тройным циклом через At и Set
+// с обходом столбцов B; эталон для проверки и замеров производительности Multiply
+func multiplyNaive(a, b Matrix) Matrix {
     if a.Cols != b.Rows {
         panic("Несовместимые размеры матриц для умножения")
     }
@@ -46,6 +418,7 @@ func Multiply(a, b Matrix) Matrix {
     }
     return result
 }
+
 // Transpose возвращает транспонированную матрицу
 // Строки становятся столбцами, столбцы - строками
 func Transpose(m Matrix) Matrix {
@@ -57,334 +430,3460 @@ func Transpose(m Matrix) Matrix {
     }
     return result
 }
-// Inverse возвращает обратную матрицу методом Гаусса-Жордана
+// Inverse возвращает обратную матрицу через LU-разложение с выбором главного элемента
 // Работает только для квадратных невырожденных матриц
 func Inverse(m Matrix) Matrix {
     if m.Rows != m.Cols {
         panic("Матрица должна быть квадратной для обращения")
     }
+    return NewLU(m).Inverse()
+}
+
+// LU - LU-разложение квадратной матрицы с частичным выбором главного элемента: P·A = L·U.
+// Одно разложение используется повторно для решения систем, определителя и обращения
+type LU struct {
+    lu    Matrix  // L (ниже диагонали, единичная диагональ не хранится) и U (диагональ и выше)
+    pivot []int   // Перестановка строк: строка i разложения - строка pivot[i] матрицы A
+    sign  float64 // Знак перестановки (+1 или -1) для определителя
+}
 
+// NewLU выполняет LU-разложение методом Гаусса с выбором главного элемента по столбцу
+func NewLU(m Matrix) LU {
+    if m.Rows != m.Cols {
+        panic("Матрица должна быть квадратной для LU-разложения")
+    }
     n := m.Rows
-    // Создаем расширенную матрицу [A|I], где I - единичная матрица
-    augmented := NewMatrix(n, 2*n, make([]float64, n*2*n))
+    lu := m.Clone()
+    pivot := make([]int, n)
+    for i := range pivot {
+        pivot[i] = i
+    }
+    sign := 1.0
 
-    // Заполняем левую часть исходной матрицей, правую - единичной
-    for i := 0; i < n; i++ {
-        for j := 0; j < n; j++ {
-            augmented.Set(i, j, m.At(i, j))
+    for k := 0; k < n; k++ {
+        // Поиск главного элемента (максимального по модулю в столбце)
+        maxRow := k
+        for i := k + 1; i < n; i++ {
+            if math.Abs(lu.At(i, k)) > math.Abs(lu.At(maxRow, k)) {
+                maxRow = i
+            }
+        }
+        if math.Abs(lu.At(maxRow, k)) < 1e-10 {
+            panic("Матрица вырождена")
+        }
+        if maxRow != k {
+            for j := 0; j < n; j++ {
+                temp := lu.At(k, j)
+                lu.Set(k, j, lu.At(maxRow, j))
+                lu.Set(maxRow, j, temp)
+            }
+            pivot[k], pivot[maxRow] = pivot[maxRow], pivot[k]
+            sign = -sign
+        }
+
+        // Исключение элементов под главным, множители сохраняются на их месте
+        for i := k + 1; i < n; i++ {
+            factor := lu.At(i, k) / lu.At(k, k)
+            lu.Set(i, k, factor)
+            for j := k + 1; j < n; j++ {
+                lu.Set(i, j, lu.At(i, j)-factor*lu.At(k, j))
+            }
         }
-        augmented.Set(i, i+n, 1.0)
     }
+    return LU{lu: lu, pivot: pivot, sign: sign}
+}
 
-    // Прямой ход метода Гаусса-Жордана
-    for i := 0; i < n; i++ {
-        // Поиск главного элемента (максимального по модулю в столбце)
-        maxRow := i
-        for k := i + 1; k < n; k++ {
-            if math.Abs(augmented.At(k, i)) > math.Abs(augmented.At(maxRow, i)) {
-                maxRow = k
+// Solve решает систему A·X = B для матрицы правых частей B (n×k)
+func (f LU) Solve(b Matrix) Matrix {
+    n := f.lu.Rows
+    if b.Rows != n {
+        panic("Несовместимые размеры матрицы правых частей")
+    }
+    x := NewMatrix(n, b.Cols, make([]float64, n*b.Cols))
+    for c := 0; c < b.Cols; c++ {
+        // Прямая подстановка L·y = P·b
+        for i := 0; i < n; i++ {
+            sum := b.At(f.pivot[i], c)
+            for j := 0; j < i; j++ {
+                sum -= f.lu.At(i, j) * x.At(j, c)
+            }
+            x.Set(i, c, sum)
+        }
+        // Обратная подстановка U·x = y
+        for i := n - 1; i >= 0; i-- {
+            sum := x.At(i, c)
+            for j := i + 1; j < n; j++ {
+                sum -= f.lu.At(i, j) * x.At(j, c)
             }
+            x.Set(i, c, sum/f.lu.At(i, i))
+        }
+    }
+    return x
+}
+
+// Det возвращает определитель матрицы
+func (f LU) Det() float64 {
+    det := f.sign
+    for i := 0; i < f.lu.Rows; i++ {
+        det *= f.lu.At(i, i)
+    }
+    return det
+}
+
+// LogDet возвращает натуральный логарифм модуля определителя
+// (без переполнения для больших матриц); знак определителя дает Det
+func (f LU) LogDet() float64 {
+    logDet := 0.0
+    for i := 0; i < f.lu.Rows; i++ {
+        logDet += math.Log(math.Abs(f.lu.At(i, i)))
+    }
+    return logDet
+}
+
+// Inverse возвращает обратную матрицу A⁻¹ = Solve(I)
+func (f LU) Inverse() Matrix {
+    return f.Solve(Identity(f.lu.Rows))
+}
+
+// choleskyTolerance - относительный порог диагонального элемента, ниже которого
+// матрица считается не положительно определенной (вырожденной)
+const choleskyTolerance = 1e-12
+
+// Cholesky - разложение Холецкого симметричной положительно определенной
+// матрицы A = L·Lᵀ (например, XᵀX). Дешевле и устойчивее LU для нормальных уравнений
+type Cholesky struct {
+    L Matrix // Нижняя треугольная матрица с положительной диагональю
+}
+
+// NewCholesky выполняет разложение Холецкого
+func NewCholesky(m Matrix) Cholesky {
+    if m.Rows != m.Cols {
+        panic("Матрица должна быть квадратной для разложения Холецкого")
+    }
+    n := m.Rows
+    L := NewMatrix(n, n, make([]float64, n*n))
+    for j := 0; j < n; j++ {
+        d := m.At(j, j) - Dot(L.Row(j)[:j], L.Row(j)[:j])
+        if d <= choleskyTolerance*math.Abs(m.At(j, j)) {
+            panic("Матрица не является положительно определенной")
         }
+        L.Set(j, j, math.Sqrt(d))
+        for i := j + 1; i < n; i++ {
+            sum := m.At(i, j) - Dot(L.Row(i)[:j], L.Row(j)[:j])
+            L.Set(i, j, sum/L.At(j, j))
+        }
+    }
+    return Cholesky{L: L}
+}
 
-        // Перестановка строк для обеспечения устойчивости алгоритма
-        if maxRow != i {
-            for j := 0; j < 2*n; j++ {
-                temp := augmented.At(i, j)
-                augmented.Set(i, j, augmented.At(maxRow, j))
-                augmented.Set(maxRow, j, temp)
+// Solve решает систему A·X = B подстановками L·y = B, Lᵀ·x = y
+func (f Cholesky) Solve(b Matrix) Matrix {
+    n := f.L.Rows
+    if b.Rows != n {
+        panic("Несовместимые размеры матрицы правых частей")
+    }
+    x := NewMatrix(n, b.Cols, make([]float64, n*b.Cols))
+    for c := 0; c < b.Cols; c++ {
+        for i := 0; i < n; i++ {
+            sum := b.At(i, c)
+            for j := 0; j < i; j++ {
+                sum -= f.L.At(i, j) * x.At(j, c)
+            }
+            x.Set(i, c, sum/f.L.At(i, i))
+        }
+        for i := n - 1; i >= 0; i-- {
+            sum := x.At(i, c)
+            for j := i + 1; j < n; j++ {
+                sum -= f.L.At(j, i) * x.At(j, c)
             }
+            x.Set(i, c, sum/f.L.At(i, i))
         }
+    }
+    return x
+}
 
-        // Нормализация текущей строки (деление на ведущий элемент)
-        pivot := augmented.At(i, i)
-        if math.Abs(pivot) < 1e-10 {
-            panic("Матрица вырождена")
+// Det возвращает определитель матрицы: произведение квадратов диагонали L
+func (f Cholesky) Det() float64 {
+    det := 1.0
+    for i := 0; i < f.L.Rows; i++ {
+        det *= f.L.At(i, i) * f.L.At(i, i)
+    }
+    return det
+}
+
+// LogDet возвращает натуральный логарифм определителя (без переполнения)
+func (f Cholesky) LogDet() float64 {
+    logDet := 0.0
+    for i := 0; i < f.L.Rows; i++ {
+        logDet += 2 * math.Log(f.L.At(i, i))
+    }
+    return logDet
+}
+
+// Inverse возвращает обратную матрицу A⁻¹ = Solve(I)
+func (f Cholesky) Inverse() Matrix {
+    return f.Solve(Identity(f.L.Rows))
+}
+
+// Параметры итерационных методов Якоби
+const (
+    jacobiMaxSweeps = 100   // Максимальное число полных проходов по парам индексов
+    jacobiTolerance = 1e-15 // Относительная точность обнуления внедиагональных элементов
+)
+
+// EigenDecomposition - спектральное разложение симметричной матрицы A = V·diag(λ)·Vᵀ
+type EigenDecomposition struct {
+    Values  []float64 // Собственные значения λ по убыванию
+    Vectors Matrix    // Собственные векторы в столбцах (в порядке Values)
+}
+
+// SymEigen выполняет спектральное разложение симметричной матрицы
+// циклическим методом вращений Якоби
+func SymEigen(m Matrix) EigenDecomposition {
+    if m.Rows != m.Cols {
+        panic("Матрица должна быть квадратной для спектрального разложения")
+    }
+    n := m.Rows
+    A := m.Clone()
+    V := Identity(n)
+
+    for sweep := 0; sweep < jacobiMaxSweeps; sweep++ {
+        // Проверка сходимости: сумма квадратов внедиагональных элементов
+        off, total := 0.0, 0.0
+        for i := 0; i < n; i++ {
+            for j := 0; j < n; j++ {
+                total += A.At(i, j) * A.At(i, j)
+                if i != j {
+                    off += A.At(i, j) * A.At(i, j)
+                }
+            }
+        }
+        if off <= jacobiTolerance*jacobiTolerance*total {
+            break
+        }
+
+        for p := 0; p < n-1; p++ {
+            for q := p + 1; q < n; q++ {
+                apq := A.At(p, q)
+                if apq == 0 {
+                    continue
+                }
+                // Угол вращения, обнуляющего элемент (p, q)
+                theta := (A.At(q, q) - A.At(p, p)) / (2 * apq)
+                t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+                if theta < 0 {
+                    t = -t
+                }
+                c := 1 / math.Sqrt(t*t+1)
+                sn := t * c
+
+                // A = Jᵀ·A·J: сначала столбцы p и q, затем строки p и q
+                for k := 0; k < n; k++ {
+                    akp, akq := A.At(k, p), A.At(k, q)
+                    A.Set(k, p, c*akp-sn*akq)
+                    A.Set(k, q, sn*akp+c*akq)
+                }
+                for k := 0; k < n; k++ {
+                    apk, aqk := A.At(p, k), A.At(q, k)
+                    A.Set(p, k, c*apk-sn*aqk)
+                    A.Set(q, k, sn*apk+c*aqk)
+                }
+                // Накопление собственных векторов V = V·J
+                for k := 0; k < n; k++ {
+                    vkp, vkq := V.At(k, p), V.At(k, q)
+                    V.Set(k, p, c*vkp-sn*vkq)
+                    V.Set(k, q, sn*vkp+c*vkq)
+                }
+            }
+        }
+    }
+
+    // Упорядочивание собственных пар по убыванию собственных значений
+    order := make([]int, n)
+    for i := range order {
+        order[i] = i
+    }
+    sort.SliceStable(order, func(a, b int) bool { return A.At(order[a], order[a]) > A.At(order[b], order[b]) })
+
+    values := make([]float64, n)
+    vectors := NewMatrix(n, n, make([]float64, n*n))
+    for j, idx := range order {
+        values[j] = A.At(idx, idx)
+        for i := 0; i < n; i++ {
+            vectors.Set(i, j, V.At(i, idx))
+        }
+    }
+    return EigenDecomposition{Values: values, Vectors: vectors}
+}
+
+// SingularValueDecomposition - усеченное сингулярное разложение A = U·diag(S)·Vᵀ
+// для матрицы A размера m×n, r = min(m, n)
+type SingularValueDecomposition struct {
+    U Matrix    // Левые сингулярные векторы в столбцах (m×r)
+    S []float64 // Сингулярные значения по убыванию (r)
+    V Matrix    // Правые сингулярные векторы в столбцах (n×r)
+}
+
+// SVD выполняет усеченное сингулярное разложение односторонним методом Якоби
+// (ортогонализация столбцов по Хестенсу). Для нулевых сингулярных значений
+// соответствующие столбцы U нулевые
+func SVD(m Matrix) SingularValueDecomposition {
+    // Для широких матриц раскладываем транспонированную: Aᵀ = V·S·Uᵀ
+    if m.Rows < m.Cols {
+        t := SVD(Transpose(m))
+        return SingularValueDecomposition{U: t.V, S: t.S, V: t.U}
+    }
+
+    rows, n := m.Rows, m.Cols
+    U := m.Clone()
+    V := Identity(n)
+
+    for sweep := 0; sweep < jacobiMaxSweeps; sweep++ {
+        rotated := false
+        for p := 0; p < n-1; p++ {
+            for q := p + 1; q < n; q++ {
+                // Элементы матрицы Грама для пары столбцов p, q
+                alpha, beta, gamma := 0.0, 0.0, 0.0
+                for i := 0; i < rows; i++ {
+                    up, uq := U.At(i, p), U.At(i, q)
+                    alpha += up * up
+                    beta += uq * uq
+                    gamma += up * uq
+                }
+                if math.Abs(gamma) <= jacobiTolerance*math.Sqrt(alpha*beta) {
+                    continue
+                }
+                rotated = true
+
+                // Вращение, делающее столбцы p и q ортогональными
+                zeta := (beta - alpha) / (2 * gamma)
+                t := 1 / (math.Abs(zeta) + math.Sqrt(1+zeta*zeta))
+                if zeta < 0 {
+                    t = -t
+                }
+                c := 1 / math.Sqrt(1+t*t)
+                sn := c * t
+                for i := 0; i < rows; i++ {
+                    up, uq := U.At(i, p), U.At(i, q)
+                    U.Set(i, p, c*up-sn*uq)
+                    U.Set(i, q, sn*up+c*uq)
+                }
+                for i := 0; i < n; i++ {
+                    vp, vq := V.At(i, p), V.At(i, q)
+                    V.Set(i, p, c*vp-sn*vq)
+                    V.Set(i, q, sn*vp+c*vq)
+                }
+            }
+        }
+        if !rotated {
+            break
+        }
+    }
+
+    // Сингулярные значения - нормы столбцов; столбцы U нормируются
+    S := make([]float64, n)
+    for j := 0; j < n; j++ {
+        S[j] = math.Sqrt(Dot(U.Col(j), U.Col(j)))
+    }
+    order := make([]int, n)
+    for i := range order {
+        order[i] = i
+    }
+    sort.SliceStable(order, func(a, b int) bool { return S[order[a]] > S[order[b]] })
+
+    result := SingularValueDecomposition{
+        U: NewMatrix(rows, n, make([]float64, rows*n)),
+        S: make([]float64, n),
+        V: NewMatrix(n, n, make([]float64, n*n)),
+    }
+    for j, idx := range order {
+        result.S[j] = S[idx]
+        for i := 0; i < rows; i++ {
+            if S[idx] > 0 {
+                result.U.Set(i, j, U.At(i, idx)/S[idx])
+            }
+        }
+        for i := 0; i < n; i++ {
+            result.V.Set(i, j, V.At(i, idx))
+        }
+    }
+    return result
+}
+
+// singularTolerance возвращает порог, ниже которого сингулярные значения
+// считаются нулевыми: max(m, n)·ε·σmax (как в LAPACK и NumPy)
+func singularTolerance(m Matrix, S []float64) float64 {
+    if len(S) == 0 {
+        return 0
+    }
+    return float64(max(m.Rows, m.Cols)) * 2.220446049250313e-16 * S[0]
+}
+
+// Rank возвращает численный ранг матрицы по сингулярным значениям.
+// tol <= 0 - порог по умолчанию max(m, n)·ε·σmax
+func Rank(m Matrix, tol float64) int {
+    svd := SVD(m)
+    if tol <= 0 {
+        tol = singularTolerance(m, svd.S)
+    }
+    rank := 0
+    for _, s := range svd.S {
+        if s > tol {
+            rank++
+        }
+    }
+    return rank
+}
+
+// PseudoInverse возвращает псевдообратную матрицу Мура-Пенроуза A⁺ = V·diag(1/S)·Uᵀ.
+// Сингулярные значения ниже порога max(m, n)·ε·σmax считаются нулевыми,
+// поэтому функция применима и к вырожденным матрицам
+func PseudoInverse(m Matrix) Matrix {
+    svd := SVD(m)
+    tol := singularTolerance(m, svd.S)
+
+    result := NewMatrix(m.Cols, m.Rows, make([]float64, m.Cols*m.Rows))
+    for k, s := range svd.S {
+        if s <= tol {
+            continue
         }
+        for i := 0; i < m.Cols; i++ {
+            vik := svd.V.At(i, k) / s
+            for j := 0; j < m.Rows; j++ {
+                result.Data[i*m.Rows+j] += vik * svd.U.At(j, k)
+            }
+        }
+    }
+    return result
+}
+
+// Mean вычисляет среднее арифметическое значение массива
+func Mean(data []float64) float64 {
+    sum := 0.0
+    for _, v := range data {
+        sum += v
+    }
+    return sum / float64(len(data))
+}
+
+// Augment дополняет матрицу независимых переменных для полиномиальной регрессии 2-го порядка
+// Преобразует матрицу X [день, температура] в расширенную матрицу с признаками:
+// [1, X1, X1², X3, X1*X3] где X1 - номер дня, X3 - температура
+func Augment(X Matrix) Matrix {
+    N := X.Rows
+    augmentedData := make([]float64, N*5)
+
+    for i := 0; i < N; i++ {
+        augmentedData[i*5+0] = 1                          // Константа (свободный член модели)
+        augmentedData[i*5+1] = X.At(i, 0)                 // X1 (номер дня - линейный эффект)
+        augmentedData[i*5+2] = X.At(i, 0) * X.At(i, 0)   // X1² (квадрат номера дня - нелинейный эффект)
+        augmentedData[i*5+3] = X.At(i, 1)                 // X3 (температура - линейный эффект)
+        augmentedData[i*5+4] = X.At(i, 0) * X.At(i, 1)   // X1*X3 (взаимодействие дня и температуры)
+    }
+
+    return NewMatrix(N, 5, augmentedData)
+}
+
+// Design описывает, как исходные признаки [день, температура] расширяются
+// в матрицу плана модели. Сохраняется вместе с моделью, чтобы при прогнозе
+// признаки строились точно так же, как при обучении
+type Design struct {
+    Name   string    `json:"name"`             // Идентификатор схемы расширения признаков
+    Terms  []string  `json:"terms"`            // Названия столбцов матрицы плана
+    Center bool      `json:"center,omitempty"` // Центрировать исходные признаки перед расширением
+    Scale  bool      `json:"scale,omitempty"`  // Делить исходные признаки на СКО перед расширением
+    Means  []float64 `json:"means,omitempty"`  // Средние исходных признаков обучающей выборки
+    Scales []float64 `json:"scales,omitempty"` // СКО исходных признаков обучающей выборки
+
+    Calendar    *CalendarFeatures    `json:"calendar,omitempty"`    // Календарные признаки (nil - не используются)
+    Temperature *TemperatureFeatures `json:"temperature,omitempty"` // Градусо-дни и кусочно-линейные члены температуры
+    Lags        *LagFeatures         `json:"lags,omitempty"`        // Лаги целевой переменной и температуры
+}
+
+// DesignPoly2 - полиномиальная модель 2-го порядка, которую строит Augment
+const DesignPoly2 = "poly2"
+
+// DefaultDesign возвращает описание расширения признаков функцией Augment
+func DefaultDesign() Design {
+    return Design{
+        Name:  DesignPoly2,
+        Terms: []string{"1", "X1", "X1^2", "X3", "X1*X3"},
+    }
+}
+
+// termNames возвращает названия столбцов матрицы плана для схемы
+func (d Design) termNames() []string {
+    var terms []string
+    switch d.Name {
+    case DesignPoly2:
+        terms = []string{"1", "X1", "X1^2", "X3", "X1*X3"}
+    default:
+        panic("Неизвестная схема расширения признаков: " + d.Name)
+    }
+    if d.Calendar != nil {
+        terms = append(terms, d.Calendar.Names()...)
+    }
+    if d.Temperature != nil {
+        terms = append(terms, d.Temperature.Names()...)
+    }
+    if d.Lags != nil {
+        terms = append(terms, d.Lags.Names()...)
+    }
+    return terms
+}
+
+// InputCols возвращает число столбцов исходных признаков, которое ожидает Apply:
+// день и температура, а при наличии лагов - также значения лагов в порядке Lags.Names
+func (d Design) InputCols() int {
+    if d.Lags == nil {
+        return 2
+    }
+    return 2 + len(d.Lags.Names())
+}
+
+// Lagged дополняет исходные признаки [день, температура] столбцами лагов.
+// Первые MaxLag наблюдений служат только предысторией и из выборки исключаются
+func (d Design) Lagged(X, Y Matrix) (Matrix, Matrix) {
+    if d.Lags == nil {
+        return X, Y
+    }
+    maxLag := d.Lags.MaxLag()
+    if X.Rows <= maxLag {
+        panic("Недостаточно наблюдений для построения лагов")
+    }
+
+    n := X.Rows - maxLag
+    cols := d.InputCols()
+    laggedX := NewMatrix(n, cols, make([]float64, n*cols))
+    laggedY := NewMatrix(n, 1, make([]float64, n))
+    temps := X.Col(1)
+    for i := maxLag; i < X.Rows; i++ {
+        row := laggedX.Row(i - maxLag)
+        row[0], row[1] = X.At(i, 0), X.At(i, 1)
+        copy(row[2:], d.Lags.Values(temps[:i], Y.Data[:i]))
+        laggedY.Set(i-maxLag, 0, Y.At(i, 0))
+    }
+    return laggedX, laggedY
+}
+
+// Fit запоминает параметры преобразования исходных признаков по обучающей
+// выборке X: средние для центрирования и СКО для масштабирования дня и температуры.
+// Центрирование до расширения ослабляет корреляцию X1 с X1² и X1*X3;
+// коэффициенты модели при этом относятся к преобразованным признакам
+func (d Design) Fit(X Matrix) Design {
+    d.Terms = d.termNames()
+    d.Means, d.Scales = nil, nil
+    if d.Center || d.Scale {
+        d.Means = make([]float64, 2)
+        d.Scales = make([]float64, 2)
+        for j := 0; j < 2; j++ {
+            col := X.Col(j)
+            d.Means[j] = Mean(col)
+            d.Scales[j] = 1
+            if d.Scale && X.Rows > 1 {
+                sumSquares := 0.0
+                for _, v := range col {
+                    sumSquares += (v - d.Means[j]) * (v - d.Means[j])
+                }
+                if sd := math.Sqrt(sumSquares / float64(X.Rows-1)); sd > 0 {
+                    d.Scales[j] = sd
+                }
+            }
+            if !d.Center {
+                d.Means[j] = 0
+            }
+        }
+    }
+    return d
+}
+
+// Apply строит матрицу плана для исходных признаков X по описанию схемы
+func (d Design) Apply(X Matrix) Matrix {
+    if X.Cols != d.InputCols() {
+        panic("Число столбцов исходных признаков не соответствует схеме")
+    }
+    raw := X
+    if d.Means != nil {
+        if len(d.Means) != 2 || len(d.Scales) != 2 {
+            panic("Параметры преобразования не соответствуют числу признаков")
+        }
+        Z := X.Slice(0, X.Rows, 0, 2)
+        for i := 0; i < Z.Rows; i++ {
+            for j, v := range Z.Row(i) {
+                Z.Set(i, j, (v-d.Means[j])/d.Scales[j])
+            }
+        }
+        X = Z
+    }
+
+    var augmentedX Matrix
+    switch d.Name {
+    case DesignPoly2:
+        augmentedX = Augment(X)
+    default:
+        panic("Неизвестная схема расширения признаков: " + d.Name)
+    }
+
+    // Календарные и температурные признаки строятся по исходным
+    // (непреобразованным) номерам дней и температурам
+    if d.Calendar != nil {
+        augmentedX = HStack(augmentedX, d.Calendar.Features(raw.Col(0)))
+    }
+    if d.Temperature != nil {
+        augmentedX = HStack(augmentedX, d.Temperature.Features(raw.Col(1)))
+    }
+    // Лаги входят в модель линейно
+    if d.Lags != nil {
+        augmentedX = HStack(augmentedX, raw.Slice(0, raw.Rows, 2, raw.Cols))
+    }
+    return augmentedX
+}
+
+// LagFeatures описывает авторегрессионные члены модели: значения потребления
+// Y(t-l) и температуры X3(t-l) за предыдущие дни
+type LagFeatures struct {
+    Y  []int `json:"y,omitempty"`  // Лаги целевой переменной (1 - вчера, 7 - неделю назад)
+    X3 []int `json:"x3,omitempty"` // Лаги температуры
+}
+
+// Names возвращает названия лаговых признаков в порядке столбцов
+func (l LagFeatures) Names() []string {
+    names := make([]string, 0, len(l.Y)+len(l.X3))
+    for _, lag := range l.Y {
+        names = append(names, fmt.Sprintf("Y(t-%d)", lag))
+    }
+    for _, lag := range l.X3 {
+        names = append(names, fmt.Sprintf("X3(t-%d)", lag))
+    }
+    return names
+}
+
+// MaxLag возвращает наибольший лаг - длину необходимой предыстории
+func (l LagFeatures) MaxLag() int {
+    maxLag := 0
+    for _, lag := range append(append([]int{}, l.Y...), l.X3...) {
+        if lag <= 0 {
+            panic("Лаг должен быть положительным")
+        }
+        maxLag = max(maxLag, lag)
+    }
+    return maxLag
+}
+
+// Values возвращает значения лагов для момента t по предыстории температур
+// temps и целевых значений ys, последний элемент которых относится к t-1
+func (l LagFeatures) Values(temps, ys []float64) []float64 {
+    if len(temps) < l.MaxLag() || len(ys) < l.MaxLag() {
+        panic("Недостаточно предыстории для лагов")
+    }
+    values := make([]float64, 0, len(l.Y)+len(l.X3))
+    for _, lag := range l.Y {
+        values = append(values, ys[len(ys)-lag])
+    }
+    for _, lag := range l.X3 {
+        values = append(values, temps[len(temps)-lag])
+    }
+    return values
+}
+
+// TemperatureFeatures описывает V-образную реакцию потребления на температуру X3:
+// градусо-дни отопления HDD = max(0, Tb - X3), охлаждения CDD = max(0, X3 - Tb)
+// и кусочно-линейные члены max(0, X3 - k) с изломом в узлах k.
+// Вместе с линейным X3 модели HDD и CDD с одинаковой базой линейно зависимы
+// (CDD - HDD = X3 - Tb), поэтому базы должны различаться (зона комфорта)
+type TemperatureFeatures struct {
+    HDD         bool      `json:"hdd,omitempty"`          // Включить градусо-дни отопления
+    HeatingBase float64   `json:"heating_base,omitempty"` // Базовая температура отопления, °C
+    CDD         bool      `json:"cdd,omitempty"`          // Включить градусо-дни охлаждения
+    CoolingBase float64   `json:"cooling_base,omitempty"` // Базовая температура охлаждения, °C
+    Knots       []float64 `json:"knots,omitempty"`        // Узлы кусочно-линейных членов, °C
+}
+
+// Names возвращает названия температурных признаков в порядке столбцов Features
+func (t TemperatureFeatures) Names() []string {
+    names := make([]string, 0)
+    if t.HDD {
+        names = append(names, fmt.Sprintf("HDD(%g)", t.HeatingBase))
+    }
+    if t.CDD {
+        names = append(names, fmt.Sprintf("CDD(%g)", t.CoolingBase))
+    }
+    for _, k := range t.Knots {
+        names = append(names, fmt.Sprintf("max(0,X3-%g)", k))
+    }
+    return names
+}
+
+// Features строит матрицу температурных признаков для температур temps
+func (t TemperatureFeatures) Features(temps []float64) Matrix {
+    cols := len(t.Names())
+    result := NewMatrix(len(temps), cols, make([]float64, len(temps)*cols))
+    for i, temp := range temps {
+        row := result.Row(i)
+        col := 0
+        if t.HDD {
+            row[col] = math.Max(0, t.HeatingBase-temp)
+            col++
+        }
+        if t.CDD {
+            row[col] = math.Max(0, temp-t.CoolingBase)
+            col++
+        }
+        for _, k := range t.Knots {
+            row[col] = math.Max(0, temp-k)
+            col++
+        }
+    }
+    return result
+}
+
+// BalancePointResult - результат поиска температуры баланса (точки излома)
+type BalancePointResult struct {
+    Temperature float64          // Оценка температуры баланса, °C
+    Grid        []float64        // Проверенные значения температуры
+    Dad         []float64        // Остаточная дисперсия для каждого значения сетки (NaN - расчет невозможен)
+    Result      RegressionResult // Регрессия при найденной температуре баланса
+}
+
+// EstimateBalancePoint оценивает температуру баланса перебором по сетке grid:
+// для каждого узла k к матрице плана добавляется член max(0, X3 - k), и
+// выбирается узел с минимальной остаточной дисперсией RunRegression.
+// Пустая сетка заменяется шагом 0.1 °C между 10% и 90% квантилями температуры
+func EstimateBalancePoint(X, Y Matrix, opts RegressionOptions, grid []float64) BalancePointResult {
+    if len(grid) == 0 {
+        temps := X.Col(1)
+        sort.Float64s(temps)
+        lo := temps[int(0.1*float64(len(temps)-1))]
+        hi := temps[int(math.Ceil(0.9*float64(len(temps)-1)))]
+        for k := lo; k <= hi+1e-9; k += 0.1 {
+            grid = append(grid, math.Round(k*10)/10)
+        }
+    }
+
+    best := BalancePointResult{Temperature: math.NaN(), Grid: grid, Dad: make([]float64, len(grid))}
+    for i, k := range grid {
+        candidate := opts
+        temperature := TemperatureFeatures{}
+        if opts.Design.Temperature != nil {
+            temperature = *opts.Design.Temperature
+        }
+        temperature.Knots = append(append([]float64{}, temperature.Knots...), k)
+        candidate.Design.Temperature = &temperature
+
+        var result RegressionResult
+        if err := safeCall(func() { result = RunRegressionWithOptions(X, Y, candidate) }); err != nil {
+            best.Dad[i] = math.NaN()
+            continue
+        }
+        best.Dad[i] = result.Dad
+        if math.IsNaN(best.Temperature) || result.Dad < best.Result.Dad {
+            best.Temperature = k
+            best.Result = result
+        }
+    }
+    if math.IsNaN(best.Temperature) {
+        panic("Температура баланса не найдена: матрица плана вырождена для всех узлов")
+    }
+    return best
+}
+
+// calendarDateLayout - формат дат календарных признаков и файла праздников
+const calendarDateLayout = "2006-01-02"
+
+// CalendarFeatures описывает календарные признаки суточной модели. Дата каждого
+// наблюдения определяется по номеру дня X1: день 1 соответствует StartDate.
+// Фиктивные переменные кодируются относительно базовой категории, чтобы не
+// дублировать свободный член. В коротком окне постоянные признаки (например,
+// месяц) делают XᵀX вырожденной - их следует включать только для длинных окон
+type CalendarFeatures struct {
+    StartDate    string   `json:"start_date"`              // Дата дня с номером 1 (ГГГГ-ММ-ДД)
+    DayOfWeek    bool     `json:"day_of_week,omitempty"`   // Дни недели (база - понедельник)
+    Holidays     []string `json:"holidays,omitempty"`      // Праздничные дни ГГГГ-ММ-ДД (индикатор праздника)
+    Month        bool     `json:"month,omitempty"`         // Месяцы (база - январь)
+    Season       bool     `json:"season,omitempty"`        // Сезоны (база - зима)
+    FourierOrder int      `json:"fourier_order,omitempty"` // Число гармоник годовой сезонности sin/cos
+}
+
+// Names возвращает названия календарных признаков в порядке столбцов Features
+func (c CalendarFeatures) Names() []string {
+    names := make([]string, 0)
+    if c.DayOfWeek {
+        names = append(names, "Вт", "Ср", "Чт", "Пт", "Сб", "Вс")
+    }
+    if len(c.Holidays) > 0 {
+        names = append(names, "Праздник")
+    }
+    if c.Month {
+        for m := 2; m <= 12; m++ {
+            names = append(names, fmt.Sprintf("Мес%d", m))
+        }
+    }
+    if c.Season {
+        names = append(names, "Весна", "Лето", "Осень")
+    }
+    for k := 1; k <= c.FourierOrder; k++ {
+        names = append(names, fmt.Sprintf("sin%d", k), fmt.Sprintf("cos%d", k))
+    }
+    return names
+}
+
+// Date возвращает календарную дату дня с номером day
+func (c CalendarFeatures) Date(day float64) time.Time {
+    start, err := time.Parse(calendarDateLayout, c.StartDate)
+    if err != nil {
+        panic("Неверная начальная дата календарных признаков: " + c.StartDate)
+    }
+    return start.AddDate(0, 0, int(math.Round(day))-1)
+}
+
+// Features строит матрицу календарных признаков для номеров дней days
+func (c CalendarFeatures) Features(days []float64) Matrix {
+    holidays := make(map[string]bool, len(c.Holidays))
+    for _, h := range c.Holidays {
+        holidays[h] = true
+    }
+
+    cols := len(c.Names())
+    result := NewMatrix(len(days), cols, make([]float64, len(days)*cols))
+    for i, day := range days {
+        date := c.Date(day)
+        row := result.Row(i)
+        col := 0
+        if c.DayOfWeek {
+            // time.Weekday: воскресенье = 0; понедельник - базовая категория
+            weekday := (int(date.Weekday()) + 6) % 7
+            if weekday > 0 {
+                row[col+weekday-1] = 1
+            }
+            col += 6
+        }
+        if len(c.Holidays) > 0 {
+            if holidays[date.Format(calendarDateLayout)] {
+                row[col] = 1
+            }
+            col++
+        }
+        if c.Month {
+            if date.Month() > time.January {
+                row[col+int(date.Month())-2] = 1
+            }
+            col += 11
+        }
+        if c.Season {
+            // Метеорологические сезоны: зима - декабрь-февраль
+            season := int(date.Month()) % 12 / 3
+            if season > 0 {
+                row[col+season-1] = 1
+            }
+            col += 3
+        }
+        // Гармоники годовой сезонности по дню года
+        phase := 2 * math.Pi * float64(date.YearDay()) / 365.25
+        for k := 1; k <= c.FourierOrder; k++ {
+            row[col] = math.Sin(float64(k) * phase)
+            row[col+1] = math.Cos(float64(k) * phase)
+            col += 2
+        }
+    }
+    return result
+}
+
+// LoadHolidays читает файл праздничных дней: по одной дате ГГГГ-ММ-ДД в строке,
+// после даты может следовать название праздника; пустые строки и строки,
+// начинающиеся с '#', пропускаются
+func LoadHolidays(path string) ([]string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    holidays := make([]string, 0)
+    scanner := bufio.NewScanner(file)
+    for line := 1; scanner.Scan(); line++ {
+        text := strings.TrimSpace(scanner.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        date := strings.Fields(text)[0]
+        if _, err := time.Parse(calendarDateLayout, date); err != nil {
+            return nil, fmt.Errorf("%s:%d: неверная дата %q", path, line, date)
+        }
+        holidays = append(holidays, date)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    return holidays, nil
+}
+
+// RegressionOptions - настройки регрессионного анализа.
+// Нулевое значение соответствует исходной модели: Augment и 95% интервалы
+type RegressionOptions struct {
+    Design      Design  `json:"design"`                // Схема расширения признаков
+    Confidence  float64 `json:"confidence"`            // Доверительная вероятность интервалов (0 - 0.95)
+    Standardize bool    `json:"standardize,omitempty"` // Стандартизовать столбцы матрицы плана перед расчетом
+    Estimator   string  `json:"estimator,omitempty"`   // Метод оценивания: МНК или ОМНК с AR(1)-ошибками ("" - МНК)
+
+    Covariance   string `json:"covariance,omitempty"`     // Оценка ковариации коэффициентов ("" - классическая)
+    NeweyWestLag int    `json:"newey_west_lag,omitempty"` // Число лагов оценки Ньюи-Уэста (0 - по правилу 4(n/100)^(2/9))
+
+    Interval  string `json:"interval,omitempty"`  // Метод интервалов: t-распределение или бутстреп ("" - t)
+    Resamples int    `json:"resamples,omitempty"` // Число бутстреп-выборок (0 - 999)
+    Seed      int64  `json:"seed,omitempty"`      // Начальное значение генератора для воспроизводимости
+}
+
+// Методы построения интервалов
+const (
+    IntervalT                 = "t"                  // ŷ ± t·SE(ŷ), нормальные ошибки
+    IntervalResidualBootstrap = "residual-bootstrap" // Бутстреп остатков, интервал прогноза по перцентилям
+    IntervalPairsBootstrap    = "pairs-bootstrap"    // Бутстреп пар (xᵢ, yᵢ), интервал прогноза по перцентилям
+)
+
+// Оценки ковариационной матрицы коэффициентов
+const (
+    CovarianceClassical = "classical"  // σ²(XᵀX)⁻¹ - постоянная дисперсия ошибок
+    CovarianceHC0       = "hc0"        // Сэндвич-оценка Уайта
+    CovarianceHC1       = "hc1"        // HC0 с поправкой на степени свободы n/(n-k)
+    CovarianceHC2       = "hc2"        // Остатки взвешены на 1/(1-hᵢ)
+    CovarianceHC3       = "hc3"        // Остатки взвешены на 1/(1-hᵢ)² (складной нож)
+    CovarianceNeweyWest = "newey-west" // HAC-оценка Ньюи-Уэста с весами Бартлетта
+)
+
+// Методы оценивания коэффициентов
+const (
+    EstimatorOLS            = "ols"             // Обычный метод наименьших квадратов
+    EstimatorCochraneOrcutt = "cochrane-orcutt" // ОМНК с AR(1)-ошибками, первое наблюдение отбрасывается
+    EstimatorPraisWinsten   = "prais-winsten"   // ОМНК с AR(1)-ошибками, первое наблюдение масштабируется
+)
+
+// Параметры итерационной оценки коэффициента автокорреляции ошибок
+const (
+    glsMaxIterations = 50    // Максимальное число итераций пересчета ρ
+    glsTolerance     = 1e-6  // Точность сходимости ρ
+    glsMaxRho        = 0.999 // Ограничение |ρ| для стационарности AR(1)
+)
+
+// DefaultRegressionOptions возвращает настройки исходной модели
+func DefaultRegressionOptions() RegressionOptions {
+    return RegressionOptions{}.withDefaults()
+}
+
+// withDefaults заполняет незаданные настройки значениями по умолчанию
+func (o RegressionOptions) withDefaults() RegressionOptions {
+    if o.Design.Name == "" {
+        o.Design.Name = DesignPoly2
+    }
+    if o.Design.Terms == nil {
+        o.Design.Terms = o.Design.termNames()
+    }
+    if o.Confidence == 0 {
+        o.Confidence = 0.95
+    }
+    if o.Estimator == "" {
+        o.Estimator = EstimatorOLS
+    }
+    if o.Covariance == "" {
+        o.Covariance = CovarianceClassical
+    }
+    if o.Interval == "" {
+        o.Interval = IntervalT
+    }
+    if o.Resamples == 0 {
+        o.Resamples = 999
+    }
+    return o
+}
+
+// standardizeColumns центрирует и масштабирует непостоянные столбцы матрицы плана:
+// zⱼ = (xⱼ - mⱼ)/sⱼ. Возвращает стандартизованную матрицу Z = X·T и матрицу T
+// обратного преобразования: так как Z·Bz = X·(T·Bz), коэффициенты в исходных
+// единицах B = T·Bz, а (XᵀX)⁻¹ = T·(ZᵀZ)⁻¹·Tᵀ. Центрирование выполняется
+// только при наличии постоянного столбца (свободного члена), который
+// принимает на себя сдвиг средних
+func standardizeColumns(X Matrix) (Matrix, Matrix) {
+    p := X.Cols
+    Z := X.Clone()
+    T := Identity(p)
+
+    // Поиск постоянного ненулевого столбца - свободного члена
+    intercept := -1
+    constant := make([]bool, p)
+    for j := 0; j < p; j++ {
+        col := X.Col(j)
+        constant[j] = true
+        for _, v := range col {
+            if v != col[0] {
+                constant[j] = false
+                break
+            }
+        }
+        if constant[j] && col[0] != 0 && intercept < 0 {
+            intercept = j
+        }
+    }
+
+    for j := 0; j < p; j++ {
+        if constant[j] {
+            continue
+        }
+        col := X.Col(j)
+        mean := 0.0
+        if intercept >= 0 {
+            mean = Mean(col)
+        }
+        sumSquares := 0.0
+        for _, v := range col {
+            sumSquares += (v - mean) * (v - mean)
+        }
+        sd := math.Sqrt(sumSquares / float64(max(X.Rows-1, 1)))
+
+        for i := 0; i < X.Rows; i++ {
+            Z.Set(i, j, (X.At(i, j)-mean)/sd)
+        }
+        // ŷ = Σ bzⱼ(xⱼ - mⱼ)/sⱼ: коэффициент при xⱼ равен bzⱼ/sⱼ,
+        // а сдвиг -bzⱼmⱼ/sⱼ переходит в свободный член
+        T.Set(j, j, 1/sd)
+        if intercept >= 0 {
+            T.Set(intercept, j, -mean/(sd*X.At(0, intercept)))
+        }
+    }
+    return Z, T
+}
+
+// fitLeastSquares решает нормальные уравнения XᵀX·B = XᵀY разложением Холецкого
+// и возвращает коэффициенты B и (XᵀX)⁻¹. При стандартизации расчет ведется по
+// стандартизованной матрице плана, а результаты пересчитываются в исходные единицы
+func fitLeastSquares(X, Y Matrix, standardize bool) (Matrix, Matrix) {
+    fitX := X
+    var T Matrix
+    if standardize {
+        fitX, T = standardizeColumns(X)
+    }
+    XT := Transpose(fitX)
+    chol := NewCholesky(Multiply(XT, fitX))
+    B := chol.Solve(Multiply(XT, Y))
+    XTXInv := chol.Inverse()
+    if standardize {
+        B = Multiply(T, B)
+        XTXInv = Multiply(Multiply(T, XTXInv), Transpose(T))
+    }
+    return B, XTXInv
+}
+
+// ar1Transform выполняет квази-разностное преобразование для AR(1)-ошибок:
+// yₜ - ρyₜ₋₁, xₜ - ρxₜ₋₁. Первое наблюдение отбрасывается (Кокрейн-Оркатт)
+// или умножается на √(1-ρ²) (Прайс-Уинстен)
+func ar1Transform(X, Y Matrix, rho float64, keepFirst bool) (Matrix, Matrix) {
+    start := 1
+    if keepFirst {
+        start = 0
+    }
+    n := X.Rows - start
+    TX := NewMatrix(n, X.Cols, make([]float64, n*X.Cols))
+    TY := NewMatrix(n, 1, make([]float64, n))
+    for t := start; t < X.Rows; t++ {
+        row := TX.Row(t - start)
+        if t == 0 {
+            scale := math.Sqrt(1 - rho*rho)
+            for j, v := range X.Row(0) {
+                row[j] = scale * v
+            }
+            TY.Set(0, 0, scale*Y.At(0, 0))
+            continue
+        }
+        for j, v := range X.Row(t) {
+            row[j] = v - rho*X.At(t-1, j)
+        }
+        TY.Set(t-start, 0, Y.At(t, 0)-rho*Y.At(t-1, 0))
+    }
+    return TX, TY
+}
+
+// fitAR1Errors оценивает коэффициенты обобщенным МНК при AR(1)-ошибках
+// итерационной процедурой Кокрейна-Оркатта или Прайса-Уинстена: по остаткам
+// текущей модели оценивается ρ, данные преобразуются и модель переоценивается
+// до сходимости ρ. Возвращает коэффициенты, (X*ᵀX*)⁻¹ преобразованной матрицы
+// плана, преобразованные данные, ρ и число итераций
+func fitAR1Errors(X, Y Matrix, opts RegressionOptions) (B, XTXInv, fitX, fitY Matrix, rho float64, iterations int) {
+    B, XTXInv = fitLeastSquares(X, Y, opts.Standardize)
+    fitX, fitY = X, Y
+    for iterations < glsMaxIterations {
+        iterations++
+
+        // Оценка ρ по остаткам исходной (непреобразованной) модели
+        YR := Multiply(X, B)
+        num, den := 0.0, 0.0
+        for t := 1; t < Y.Rows; t++ {
+            e, ePrev := Y.At(t, 0)-YR.At(t, 0), Y.At(t-1, 0)-YR.At(t-1, 0)
+            num += e * ePrev
+            den += ePrev * ePrev
+        }
+        newRho := 0.0
+        if den > 0 {
+            newRho = math.Max(-glsMaxRho, math.Min(glsMaxRho, num/den))
+        }
+
+        fitX, fitY = ar1Transform(X, Y, newRho, opts.Estimator == EstimatorPraisWinsten)
+        B, XTXInv = fitLeastSquares(fitX, fitY, opts.Standardize)
+
+        converged := math.Abs(newRho-rho) < glsTolerance
+        rho = newRho
+        if converged {
+            break
+        }
+    }
+    return B, XTXInv, fitX, fitY, rho, iterations
+}
+
+// maxLeverage - верхняя граница рычага hᵢ = xᵢ(XᵀX)⁻¹xᵢᵀ в поправках HC2/HC3
+const maxLeverage = 1 - 1e-8
+
+// SandwichCovariance возвращает устойчивую оценку ковариационной матрицы
+// коэффициентов G·(XᵀΩX)·G, где G = (XᵀX)⁻¹, а «мясо» XᵀΩX строится по
+// остаткам residuals: HC0-HC3 устойчивы к гетероскедастичности (разной
+// дисперсии будних и выходных дней), Ньюи-Уэста - также к автокорреляции
+// с lag лагами (lag <= 0 - по правилу 4(n/100)^(2/9)).
+// Рычаги hᵢ в HC2/HC3 ограничены сверху maxLeverage: наблюдение с hᵢ = 1
+// (например, единственная строка праздника в окне) дает нулевой остаток,
+// и без ограничения вес 0/0 превратил бы стандартные ошибки в NaN или ±Inf
+func SandwichCovariance(X Matrix, residuals []float64, G Matrix, kind string, lag int) Matrix {
+    n, k := X.Rows, X.Cols
+    if len(residuals) != n {
+        panic("Число остатков не совпадает с числом наблюдений")
+    }
+
+    // Веса квадратов остатков ωᵢ
+    weights := make([]float64, n)
+    for i, e := range residuals {
+        h := math.Min(QuadForm(X.Row(i), G), maxLeverage)
+        switch kind {
+        case CovarianceHC0, CovarianceNeweyWest:
+            weights[i] = e * e
+        case CovarianceHC1:
+            weights[i] = e * e * float64(n) / float64(n-k)
+        case CovarianceHC2:
+            weights[i] = e * e / (1 - h)
+        case CovarianceHC3:
+            weights[i] = e * e / ((1 - h) * (1 - h))
+        default:
+            panic("Неизвестная оценка ковариации: " + kind)
+        }
+    }
+
+    meat := NewMatrix(k, k, make([]float64, k*k))
+    for i := 0; i < n; i++ {
+        xi := X.Row(i)
+        for a := 0; a < k; a++ {
+            for b := 0; b < k; b++ {
+                meat.Data[a*k+b] += weights[i] * xi[a] * xi[b]
+            }
+        }
+    }
+
+    // Автоковариации скоров с весами Бартлетта wₗ = 1 - l/(L+1)
+    if kind == CovarianceNeweyWest {
+        if lag <= 0 {
+            lag = int(math.Floor(4 * math.Pow(float64(n)/100, 2.0/9)))
+        }
+        for l := 1; l <= lag && l < n; l++ {
+            w := 1 - float64(l)/float64(lag+1)
+            for t := l; t < n; t++ {
+                xt, xs := X.Row(t), X.Row(t-l)
+                c := w * residuals[t] * residuals[t-l]
+                for a := 0; a < k; a++ {
+                    for b := 0; b < k; b++ {
+                        meat.Data[a*k+b] += c * (xt[a]*xs[b] + xs[a]*xt[b])
+                    }
+                }
+            }
+        }
+    }
+
+    return Multiply(Multiply(G, meat), G)
+}
+
+// bootstrapDraws формирует бутстреп-распределение прогноза: resamples наборов
+// коэффициентов B* (строки матрицы) и столько же случайных ошибок нового
+// наблюдения. Прогноз для xᵢ с учетом неопределенности коэффициентов и
+// ошибки - xᵢB*ᵣ + e*ᵣ; его перцентили дают интервал прогноза без
+// предположения о нормальности остатков
+func bootstrapDraws(X, Y, B Matrix, opts RegressionOptions) (Matrix, []float64) {
+    n, k := X.Rows, X.Cols
+    rng := rand.New(rand.NewSource(opts.Seed))
+
+    // Центрированные остатки, масштабированные на √(n/(n-k)) для несмещенности дисперсии
+    YR := Multiply(X, B)
+    residuals := make([]float64, n)
+    for i := 0; i < n; i++ {
+        residuals[i] = Y.At(i, 0) - YR.At(i, 0)
+    }
+    meanResidual := Mean(residuals)
+    inflation := math.Sqrt(float64(n) / float64(n-k))
+    for i := range residuals {
+        residuals[i] = (residuals[i] - meanResidual) * inflation
+    }
+
+    draws := NewMatrix(opts.Resamples, k, make([]float64, opts.Resamples*k))
+    errors := make([]float64, opts.Resamples)
+    sampleX := NewMatrix(n, k, make([]float64, n*k))
+    sampleY := NewMatrix(n, 1, make([]float64, n))
+    for r := 0; r < opts.Resamples; r++ {
+        var Bstar Matrix
+        // Вырожденные выборки (возможны в бутстрепе пар) заменяются новыми
+        for attempt := 0; ; attempt++ {
+            for i := 0; i < n; i++ {
+                switch opts.Interval {
+                case IntervalResidualBootstrap:
+                    copy(sampleX.Row(i), X.Row(i))
+                    sampleY.Set(i, 0, YR.At(i, 0)+residuals[rng.Intn(n)])
+                case IntervalPairsBootstrap:
+                    j := rng.Intn(n)
+                    copy(sampleX.Row(i), X.Row(j))
+                    sampleY.Set(i, 0, Y.At(j, 0))
+                }
+            }
+            err := safeCall(func() { Bstar, _ = fitLeastSquares(sampleX, sampleY, opts.Standardize) })
+            if err == nil {
+                break
+            }
+            if attempt == 100 {
+                panic("Бутстреп: не удалось получить невырожденную выборку")
+            }
+        }
+        copy(draws.Row(r), Bstar.Data)
+        errors[r] = residuals[rng.Intn(n)]
+    }
+    return draws, errors
+}
+
+// Quantile возвращает выборочный квантиль уровня p с линейной интерполяцией
+// между порядковыми статистиками (тип 7 по Хиндману-Фану)
+func Quantile(data []float64, p float64) float64 {
+    if len(data) == 0 {
+        panic("Пустая выборка для квантиля")
+    }
+    sorted := append([]float64{}, data...)
+    sort.Float64s(sorted)
+    h := p * float64(len(sorted)-1)
+    lo := int(math.Floor(h))
+    if lo >= len(sorted)-1 {
+        return sorted[len(sorted)-1]
+    }
+    return sorted[lo] + (h-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// bootstrapInterval возвращает перцентильный интервал для вектора xᵢ матрицы
+// плана по бутстреп-коэффициентам draws: с ошибками errors - интервал прогноза
+// нового наблюдения xᵢB*ᵣ + e*ᵣ, при errors = nil - доверительный интервал
+// среднего xᵢB*ᵣ; shift - поправка прогноза (например, ρʰ·eₙ для AR(1)-ошибок)
+func bootstrapInterval(xi []float64, draws Matrix, errors []float64, shift, confidence float64) (float64, float64) {
+    values := make([]float64, draws.Rows)
+    for r := range values {
+        values[r] = Dot(xi, draws.Row(r)) + shift
+        if errors != nil {
+            values[r] += errors[r]
+        }
+    }
+    return Quantile(values, (1-confidence)/2), Quantile(values, (1+confidence)/2)
+}
+
+// Пороги диагностики мультиколлинеарности (по Белсли)
+const (
+    VIFThreshold                = 10.0 // Фактор инфляции дисперсии, выше которого выдается предупреждение
+    ConditionIndexThreshold     = 30.0 // Индекс обусловленности, указывающий на сильную зависимость
+    varianceProportionThreshold = 0.5  // Доля дисперсии коэффициента, связанная с одним измерением
+)
+
+// CollinearityDiagnostics - диагностика мультиколлинеарности матрицы плана
+type CollinearityDiagnostics struct {
+    Terms               []string  // Названия столбцов матрицы плана
+    VIF                 []float64 // Факторы инфляции дисперсии (0 для свободного члена)
+    ConditionIndices    []float64 // Индексы обусловленности σmax/σk по возрастанию
+    VarianceProportions Matrix    // Доли дисперсии: строка - измерение k, столбец - коэффициент
+}
+
+// Collinearity рассчитывает факторы инфляции дисперсии, индексы обусловленности
+// и таблицу долей дисперсии коэффициентов для матрицы плана X
+func Collinearity(X Matrix, terms []string) CollinearityDiagnostics {
+    p := X.Cols
+    d := CollinearityDiagnostics{Terms: terms, VIF: make([]float64, p)}
+
+    // VIFⱼ - диагональ матрицы, обратной к корреляционной матрице
+    // непостоянных столбцов (свободный член в расчет не входит)
+    columns := make([][]float64, 0, p)
+    index := make([]int, 0, p)
+    for j := 0; j < p; j++ {
+        col := X.Col(j)
+        constant := true
+        for _, v := range col {
+            if v != col[0] {
+                constant = false
+                break
+            }
+        }
+        if !constant {
+            columns = append(columns, col)
+            index = append(index, j)
+        }
+    }
+    if len(columns) > 0 {
+        R := Identity(len(columns))
+        for a := range columns {
+            for b := a + 1; b < len(columns); b++ {
+                r := Correlation(columns[a], columns[b])
+                R.Set(a, b, r)
+                R.Set(b, a, r)
+            }
+        }
+        var RInv Matrix
+        if err := safeCall(func() { RInv = NewCholesky(R).Inverse() }); err != nil {
+            // Точная линейная зависимость столбцов
+            for _, j := range index {
+                d.VIF[j] = math.Inf(1)
+            }
+        } else {
+            for a, j := range index {
+                d.VIF[j] = RInv.At(a, a)
+            }
+        }
+    }
+
+    // Индексы обусловленности и доли дисперсии по Белсли: сингулярное
+    // разложение матрицы плана со столбцами, нормированными к единичной длине
+    scaled := X.Clone()
+    for j := 0; j < p; j++ {
+        col := scaled.Col(j)
+        norm := math.Sqrt(Dot(col, col))
+        if norm == 0 {
+            continue
+        }
+        for i := 0; i < scaled.Rows; i++ {
+            scaled.Set(i, j, scaled.At(i, j)/norm)
+        }
+    }
+    svd := SVD(scaled)
+    dims := len(svd.S)
+    d.ConditionIndices = make([]float64, dims)
+    d.VarianceProportions = NewMatrix(dims, p, make([]float64, dims*p))
+    for k := 0; k < dims; k++ {
+        d.ConditionIndices[k] = svd.S[0] / svd.S[k]
+    }
+    for j := 0; j < p; j++ {
+        // φₖⱼ = vⱼₖ²/σₖ², πₖⱼ = φₖⱼ / Σₖ φₖⱼ
+        total := 0.0
+        for k := 0; k < dims; k++ {
+            phi := svd.V.At(j, k) * svd.V.At(j, k) / (svd.S[k] * svd.S[k])
+            d.VarianceProportions.Set(k, j, phi)
+            total += phi
+        }
+        for k := 0; k < dims; k++ {
+            d.VarianceProportions.Set(k, j, d.VarianceProportions.At(k, j)/total)
+        }
+    }
+    return d
+}
+
+// Warnings возвращает предупреждения о превышении порогов мультиколлинеарности
+func (d CollinearityDiagnostics) Warnings() []string {
+    warnings := make([]string, 0)
+    for j, vif := range d.VIF {
+        if vif > VIFThreshold {
+            warnings = append(warnings, fmt.Sprintf("VIF(%s) = %.1f превышает %.0f", d.Terms[j], vif, VIFThreshold))
+        }
+    }
+    for k, eta := range d.ConditionIndices {
+        if eta <= ConditionIndexThreshold {
+            continue
+        }
+        // Коэффициенты, большая доля дисперсии которых связана с измерением k
+        involved := make([]string, 0)
+        for j := range d.Terms {
+            if d.VarianceProportions.At(k, j) > varianceProportionThreshold {
+                involved = append(involved, d.Terms[j])
+            }
+        }
+        if len(involved) >= 2 {
+            warnings = append(warnings, fmt.Sprintf("Индекс обусловленности %.1f превышает %.0f, зависимость между %v", eta, ConditionIndexThreshold, involved))
+        }
+    }
+    return warnings
+}
+
+// RegressionResult содержит полные результаты регрессионного анализа
+type RegressionResult struct {
+    YR[] float64 // Расчетные значения зависимой переменной Y
+    B  Matrix // Коэффициенты регрессии [B0, B1, B2, B3, B4]
+    YConfLow []float64 // Нижние границы 95% доверительных интервалов среднего Y (для любого метода интервалов)
+    YConfHigh []float64 // Верхние границы 95% доверительных интервалов среднего Y (для любого метода интервалов)
+    Correlation float64 // Коэффициент корреляции между Y и YR
+    Decision string // Решение об адекватности модели ("Адекватна"/"Неадекватна")
+    G Matrix // Матрица (XᵀX)⁻¹, нужна для доверительных интервалов прогноза
+    Dad float64 // Остаточная дисперсия (дисперсия адекватности)
+    DF int // Степени свободы остаточной дисперсии (N - k)
+    Leverage []float64 // Левериджи наблюдений xᵢ(XᵀX)⁻¹xᵢᵀ
+    Design Design // Описание расширения признаков, на котором построена модель
+    Confidence float64 // Доверительная вероятность интервалов YConfLow/YConfHigh
+    Collinearity CollinearityDiagnostics // Диагностика мультиколлинеарности матрицы плана
+    Warnings []string // Предупреждения о качестве модели (мультиколлинеарность и т.п.)
+    SE []float64 // Стандартные ошибки коэффициентов (для ОМНК - скорректированные)
+    Estimator string // Метод оценивания (EstimatorOLS, EstimatorCochraneOrcutt, EstimatorPraisWinsten)
+    Rho float64 // Коэффициент автокорреляции AR(1)-ошибок (0 для МНК)
+    Iterations int // Число итераций оценки ρ (0 для МНК)
+    LastResidual float64 // Остаток последнего наблюдения окна для поправки прогноза на ρ
+    Cov Matrix // Ковариационная матрица коэффициентов (классическая или устойчивая)
+    Covariance string // Вид оценки ковариации (CovarianceClassical, CovarianceHC0, ...)
+    F float64 // F-статистика проверки адекватности
+    FCritical float64 // Критическое значение F для уровня значимости 5%
+    Interval string // Метод интервалов (IntervalT или бутстреп)
+    BootstrapB Matrix // Бутстреп-наборы коэффициентов по строкам (только для бутстрепа)
+    BootstrapErrors []float64 // Бутстреп-ошибки нового наблюдения (только для бутстрепа)
+}
+
+// RunRegression выполняет полный регрессионный анализ по методу наименьших квадратов
+// Возвращает коэффициенты модели, прогнозы и статистики качества
+func RunRegression(X, Y Matrix) RegressionResult {
+    return RunRegressionWithOptions(X, Y, DefaultRegressionOptions())
+}
+
+// RunRegressionWithOptions - RunRegression с настройками схемы признаков и интервалов
+func RunRegressionWithOptions(X, Y Matrix, opts RegressionOptions) RegressionResult {
+    opts = opts.withDefaults()
+
+    // 1. Расширение матрицы признаков для полиномиальной регрессии.
+    // При лаговых признаках первые наблюдения служат только предысторией
+    X, Y = opts.Design.Lagged(X, Y)
+    design := opts.Design.Fit(X)
+    augmentedX := design.Apply(X)
+
+    // 2. Расчет коэффициентов регрессии из нормальных уравнений XᵀX·B = XᵀY.
+    // При ОМНК с AR(1)-ошибками уравнения решаются для преобразованных
+    // данных fitX, fitY, по ним же оцениваются остаточная дисперсия и F-критерий
+    fitX, fitY := augmentedX, Y
+    var B, XTXInv Matrix
+    rho, iterations := 0.0, 0
+    switch opts.Estimator {
+    case EstimatorOLS:
+        B, XTXInv = fitLeastSquares(augmentedX, Y, opts.Standardize)
+    case EstimatorCochraneOrcutt, EstimatorPraisWinsten:
+        B, XTXInv, fitX, fitY, rho, iterations = fitAR1Errors(augmentedX, Y, opts)
+    default:
+        panic("Неизвестный метод оценивания: " + opts.Estimator)
+    }
+
+    // 3. Расчет прогнозных значений YR = X * B
+    YRMatrix := Multiply(augmentedX, B)
+    YR := make([]float64, Y.Rows)
+    for i := 0; i < Y.Rows; i++ {
+        YR[i] = YRMatrix.At(i, 0)
+    }
+
+    // 4. Проверка адекватности модели по F-критерию Фишера
+    N := fitX.Rows // Количество наблюдений (после преобразования ОМНК)
+    k := fitX.Cols // Количество параметров модели (5)
+
+    // Дисперсия адекватности (остаточная дисперсия)
+    fitYR := YRMatrix
+    if opts.Estimator != EstimatorOLS {
+        fitYR = Multiply(fitX, B)
+    }
+    sumSquaredErrors := 0.0
+    for i := 0; i < N; i++ {
+        error := fitY.At(i, 0) - fitYR.At(i, 0)
+        sumSquaredErrors += error * error
+    }
+    Dad := sumSquaredErrors / float64(N-k)
+
+    // Общая дисперсия зависимой переменной
+    YSR := Mean(fitY.Data)
+    totalSumSquares := 0.0
+    for i := 0; i < N; i++ {
+        totalSumSquares += (fitY.At(i, 0) - YSR) * (fitY.At(i, 0) - YSR)
+    }
+    DY := totalSumSquares / float64(N-1)
+
+    // F-статистика: отношение объясненной дисперсии к остаточной
+    FR := DY / Dad
+
+    // Критическое значение F-распределения для уровня значимости 5%
+    alpha := 0.05
+    df1 := k - 1  // Степени свободы числителя
+    df2 := N - k  // Степени свободы знаменателя
+    Fcritical := FInv(alpha, df1, df2)
+
+    // Коэффициент корреляции между фактическими и расчетными значениями
+    correlation := Correlation(Y.Data, YR)
+
+    // Проверка адекватности: если F > Fкрит, модель адекватна
+    decision := "Неадекватна"
+    if FR > Fcritical {
+        decision = "Адекватна"
+    }
+
+    // 5. Расчет доверительных интервалов для прогнозных значений
+    G := XTXInv // Матрица ковариаций коэффициентов (XᵀX)⁻¹
+    df := N - k // Степени свободы
+    tValue := TInv((1+opts.Confidence)/2, df) // Критическое значение t-статистики
+
+    // Ковариационная матрица коэффициентов: классическая σ²(XᵀX)⁻¹
+    // или устойчивая сэндвич-оценка по остаткам расчетной выборки
+    var Cov Matrix
+    if opts.Covariance == CovarianceClassical {
+        Cov = Scale(G, Dad)
+    } else {
+        residuals := make([]float64, N)
+        for i := 0; i < N; i++ {
+            residuals[i] = fitY.At(i, 0) - fitYR.At(i, 0)
+        }
+        Cov = SandwichCovariance(fitX, residuals, G, opts.Covariance, opts.NeweyWestLag)
+    }
+
+    YConfLow := make([]float64, Y.Rows)
+    YConfHigh := make([]float64, Y.Rows)
+    leverage := make([]float64, Y.Rows)
+
+    for i := 0; i < Y.Rows; i++ {
+        // Дисперсия прогноза: Var(ŷ) = σ² * xᵢ(XᵀX)⁻¹xᵢᵀ,
+        // где xᵢ(XᵀX)⁻¹xᵢᵀ - леверидж (диагональ матрицы-проектора) наблюдения;
+        // для устойчивых оценок Var(ŷ) = xᵢ·Cov(B)·xᵢᵀ
+        leverage[i] = QuadForm(augmentedX.Row(i), G)
+        SE_YR := math.Sqrt(leverage[i] * Dad) // Стандартная ошибка прогноза
+        if opts.Covariance != CovarianceClassical {
+            SE_YR = math.Sqrt(QuadForm(augmentedX.Row(i), Cov))
+        }
+
+        // Доверительный интервал: ŷ ± t(α/2, df) * SE(ŷ)
+        YConfLow[i] = YR[i] - tValue*SE_YR
+        YConfHigh[i] = YR[i] + tValue*SE_YR
+    }
+
+    // Бутстреп-интервалы заменяют интервалы по t-распределению; на обучающей
+    // выборке, как и для t, это доверительные интервалы среднего (без ошибки e*)
+    var bootstrapB Matrix
+    var bootstrapErrors []float64
+    switch opts.Interval {
+    case IntervalT:
+    case IntervalResidualBootstrap, IntervalPairsBootstrap:
+        bootstrapB, bootstrapErrors = bootstrapDraws(fitX, fitY, B, opts)
+        for i := 0; i < Y.Rows; i++ {
+            YConfLow[i], YConfHigh[i] = bootstrapInterval(augmentedX.Row(i), bootstrapB, nil, 0, opts.Confidence)
+        }
+    default:
+        panic("Неизвестный метод интервалов: " + opts.Interval)
+    }
+
+    // Стандартные ошибки коэффициентов: SE(Bⱼ) = √Cov(B)ⱼⱼ
+    SE := make([]float64, k)
+    for j := 0; j < k; j++ {
+        SE[j] = math.Sqrt(Cov.At(j, j))
+    }
+
+    // 6. Диагностика мультиколлинеарности матрицы плана
+    collinearity := Collinearity(augmentedX, design.Terms)
+
+    return RegressionResult{
+        YR:              YR,
+        B:               B,
+        YConfLow:        YConfLow,
+        YConfHigh:       YConfHigh,
+        Correlation:     correlation,
+        Decision:        decision,
+        G:               G,
+        Dad:             Dad,
+        DF:              df,
+        Leverage:        leverage,
+        Design:          design,
+        Confidence:      opts.Confidence,
+        Collinearity:    collinearity,
+        Warnings:        collinearity.Warnings(),
+        SE:              SE,
+        Estimator:       opts.Estimator,
+        Rho:             rho,
+        Iterations:      iterations,
+        LastResidual:    Y.At(Y.Rows-1, 0) - YR[Y.Rows-1],
+        Cov:             Cov,
+        Covariance:      opts.Covariance,
+        F:               FR,
+        FCritical:       Fcritical,
+        Interval:        opts.Interval,
+        BootstrapB:      bootstrapB,
+        BootstrapErrors: bootstrapErrors,
+    }
+}
+
+// ModelFormatVersion - текущая версия формата файла модели.
+// Увеличивается при любом несовместимом изменении структуры Model
+const ModelFormatVersion = 1
+
+// Model содержит всё необходимое для прогноза с доверительными интервалами
+// без исходной обучающей выборки: коэффициенты, (XᵀX)⁻¹, остаточную дисперсию
+// и описание расширения признаков
+type Model struct {
+    Version    int       `json:"version"`    // Версия формата файла модели
+    Design     Design    `json:"design"`     // Схема расширения признаков
+    B          []float64 `json:"b"`          // Коэффициенты регрессии [B0, B1, ...]
+    G          Matrix    `json:"g"`          // Матрица (XᵀX)⁻¹
+    Dad        float64   `json:"dad"`        // Остаточная дисперсия
+    DF         int       `json:"df"`         // Степени свободы остаточной дисперсии
+    Confidence float64   `json:"confidence"` // Доверительная вероятность интервалов
+
+    Rho          float64 `json:"rho,omitempty"`           // Коэффициент автокорреляции AR(1)-ошибок
+    LastResidual float64 `json:"last_residual,omitempty"` // Остаток последнего наблюдения обучающего окна
+    Cov          *Matrix `json:"cov,omitempty"`           // Устойчивая ковариация коэффициентов (nil - σ²(XᵀX)⁻¹)
+
+    BootstrapB      *Matrix   `json:"bootstrap_b,omitempty"`      // Бутстреп-наборы коэффициентов (nil - интервалы по t)
+    BootstrapErrors []float64 `json:"bootstrap_errors,omitempty"` // Бутстреп-ошибки нового наблюдения
+}
+
+// Forecast - точечный прогноз с границами доверительного интервала.
+// Для t-метода это доверительный интервал среднего xᵢB, для бутстрепа -
+// перцентильный интервал прогноза нового наблюдения
+type Forecast struct {
+    Y    float64 `json:"y"`    // Точечный прогноз
+    Low  float64 `json:"low"`  // Нижняя граница доверительного интервала
+    High float64 `json:"high"` // Верхняя граница доверительного интервала
+}
+
+// NewModel формирует модель для сохранения из результатов регрессии
+func NewModel(result RegressionResult) Model {
+    var cov *Matrix
+    if result.Covariance != "" && result.Covariance != CovarianceClassical {
+        c := result.Cov.Clone()
+        cov = &c
+    }
+    var bootstrapB *Matrix
+    if len(result.BootstrapErrors) > 0 {
+        b := result.BootstrapB.Clone()
+        bootstrapB = &b
+    }
+    return Model{
+        Version:    ModelFormatVersion,
+        Design:     result.Design,
+        B:          result.B.Clone().Data,
+        G:          result.G.Clone(),
+        Dad:        result.Dad,
+        DF:         result.DF,
+        Confidence: result.Confidence,
+
+        Rho:          result.Rho,
+        LastResidual: result.LastResidual,
+        Cov:          cov,
+
+        BootstrapB:      bootstrapB,
+        BootstrapErrors: append([]float64(nil), result.BootstrapErrors...),
+    }
+}
+
+// Validate проверяет согласованность размеров и версии модели
+func (m Model) Validate() error {
+    if m.Version != ModelFormatVersion {
+        return fmt.Errorf("неподдерживаемая версия модели %d (ожидается %d)", m.Version, ModelFormatVersion)
+    }
+    if m.Design.Name != DesignPoly2 {
+        return fmt.Errorf("неизвестная схема расширения признаков %q", m.Design.Name)
+    }
+    if m.Design.Calendar != nil {
+        if _, err := time.Parse(calendarDateLayout, m.Design.Calendar.StartDate); err != nil {
+            return fmt.Errorf("неверная начальная дата календарных признаков: %w", err)
+        }
+    }
+    if m.Design.Lags != nil {
+        for _, lag := range append(append([]int{}, m.Design.Lags.Y...), m.Design.Lags.X3...) {
+            if lag <= 0 {
+                return fmt.Errorf("лаг %d должен быть положительным", lag)
+            }
+        }
+    }
+    terms := m.Design.termNames()
+    if len(m.Design.Terms) != len(terms) {
+        return fmt.Errorf("список признаков %v не соответствует схеме %v", m.Design.Terms, terms)
+    }
+    if len(m.B) == 0 || len(m.B) != len(terms) {
+        return fmt.Errorf("число коэффициентов %d не совпадает с числом признаков %d", len(m.B), len(terms))
+    }
+    if m.G.Rows != len(m.B) || m.G.Cols != len(m.B) || len(m.G.Data) != len(m.B)*len(m.B) {
+        return fmt.Errorf("матрица (XᵀX)⁻¹ должна иметь размер %d×%d", len(m.B), len(m.B))
+    }
+    if m.Design.Lags != nil && len(m.Design.Lags.Names()) == 0 {
+        return fmt.Errorf("описание лагов не содержит ни одного лага")
+    }
+    if m.Design.Means != nil && (len(m.Design.Means) != 2 || len(m.Design.Scales) != 2) {
+        return fmt.Errorf("параметры преобразования признаков должны содержать 2 значения")
+    }
+    if m.Cov != nil && (m.Cov.Rows != len(m.B) || m.Cov.Cols != len(m.B) || len(m.Cov.Data) != len(m.B)*len(m.B)) {
+        return fmt.Errorf("ковариационная матрица должна иметь размер %d×%d", len(m.B), len(m.B))
+    }
+    if m.BootstrapB != nil && (m.BootstrapB.Cols != len(m.B) || m.BootstrapB.Rows != len(m.BootstrapErrors) || len(m.BootstrapB.Data) != m.BootstrapB.Rows*m.BootstrapB.Cols) {
+        return fmt.Errorf("бутстреп-наборы должны иметь %d столбцов и по одной ошибке на строку", len(m.B))
+    }
+    if m.DF <= 0 {
+        return fmt.Errorf("степени свободы должны быть положительными")
+    }
+    if m.Confidence <= 0 || m.Confidence >= 1 {
+        return fmt.Errorf("доверительная вероятность должна быть в интервале (0, 1)")
+    }
+    return nil
+}
+
+// SaveModel сохраняет модель в файл формата JSON
+func SaveModel(path string, m Model) error {
+    data, err := json.MarshalIndent(m, "", "  ")
+    if err != nil {
+        return fmt.Errorf("сериализация модели: %w", err)
+    }
+    return os.WriteFile(path, data, 0o644)
+}
+
+// LoadModel загружает модель из файла и проверяет её согласованность
+func LoadModel(path string) (Model, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return Model{}, err
+    }
+    var m Model
+    if err := json.Unmarshal(data, &m); err != nil {
+        return Model{}, fmt.Errorf("разбор файла модели %s: %w", path, err)
+    }
+    if err := m.Validate(); err != nil {
+        return Model{}, fmt.Errorf("файл модели %s: %w", path, err)
+    }
+    return m, nil
+}
+
+// Predict вычисляет прогнозы с доверительными интервалами для строк X
+// (каждая строка - исходные признаки [день, температура], а для модели
+// с лагами - также значения лагов в порядке Design.Lags.Names).
+// Для модели с AR(1)-ошибками строки считаются последовательными днями после
+// обучающего окна, и к прогнозу на h-й день добавляется поправка ρʰ·eₙ
+func (m Model) Predict(X Matrix) []Forecast {
+    return m.predictAhead(X, 1)
+}
+
+// predictAhead - Predict для строк X, первая из которых отстоит
+// от последнего наблюдения обучающего окна на h дней
+func (m Model) predictAhead(X Matrix, h int) []Forecast {
+    augmentedX := m.Design.Apply(X)
+    tValue := TInv((1+m.Confidence)/2, m.DF)
+
+    forecasts := make([]Forecast, augmentedX.Rows)
+    for i := 0; i < augmentedX.Rows; i++ {
+        // Точечный прогноз ŷ = xᵢB и стандартная ошибка по xᵢ(XᵀX)⁻¹xᵢᵀ
+        xi := augmentedX.Row(i)
+        shift := math.Pow(m.Rho, float64(h+i)) * m.LastResidual
+        y := Dot(xi, m.B) + shift
+
+        // Бутстреп-модель: перцентильный интервал прогноза
+        if m.BootstrapB != nil {
+            low, high := bootstrapInterval(xi, *m.BootstrapB, m.BootstrapErrors, shift, m.Confidence)
+            forecasts[i] = Forecast{Y: y, Low: low, High: high}
+            continue
+        }
+
+        SE := math.Sqrt(QuadForm(xi, m.G) * m.Dad)
+        if m.Cov != nil {
+            SE = math.Sqrt(QuadForm(xi, *m.Cov))
+        }
+
+        forecasts[i] = Forecast{Y: y, Low: y - tValue*SE, High: y + tValue*SE}
+    }
+    return forecasts
+}
+
+// Predict загружает модель из файла и строит прогнозы для строк X
+func Predict(path string, X Matrix) ([]Forecast, error) {
+    m, err := LoadModel(path)
+    if err != nil {
+        return nil, err
+    }
+    if X.Cols != m.Design.InputCols() {
+        return nil, fmt.Errorf("матрица X содержит %d столбцов, модель ожидает %d", X.Cols, m.Design.InputCols())
+    }
+    var forecasts []Forecast
+    if err := safeCall(func() { forecasts = m.Predict(X) }); err != nil {
+        return nil, err
+    }
+    return forecasts, nil
+}
+
+// PredictionResult содержит результаты прогнозирования на новых данных
+type PredictionResult struct {
+    Predictions     []float64   // Точечные прогнозы для новых наблюдений
+    PredictionsLow  []float64   // Нижние границы доверительных интервалов
+    PredictionsHigh []float64   // Верхние границы доверительных интервалов
+    Actuals         []float64   // Фактические значения для проверки точности
+    Days            []int       // Номера дней, для которых сделан прогноз
+    Confidence      float64     // Номинальная доверительная вероятность интервалов
+    Terms           []string    // Названия коэффициентов моделей истории
+    History         []ModelStep // Модели окна, по которым сделан прогноз каждого дня
+    WindowSizes     []int       // Длина окна, по которому сделан прогноз каждого дня
+    ChangePoints    []int       // Дни, фактические значения которых вызвали сигнал о смене режима
+}
+
+// ModelStep - модель скользящего окна на одном шаге прогноза
+type ModelStep struct {
+    Day         int       `json:"day"`          // Номер дня, прогнозируемого этой моделью
+    WindowStart float64   `json:"window_start"` // Номер первого дня окна
+    WindowEnd   float64   `json:"window_end"`   // Номер последнего дня окна
+    B           []float64 `json:"b"`            // Коэффициенты регрессии
+    SE          []float64 `json:"se"`           // Стандартные ошибки коэффициентов
+    Dad         float64   `json:"dad"`          // Остаточная дисперсия
+    F           float64   `json:"f"`            // F-статистика проверки адекватности
+    FCritical   float64   `json:"f_critical"`   // Критическое значение F
+    Decision    string    `json:"decision"`     // Решение об адекватности модели
+    Correlation float64   `json:"correlation"`  // Коэффициент корреляции Y и YR
+}
+
+// WriteHistoryCSV записывает историю моделей result.History в w в формате CSV:
+// строка заголовка и по строке на шаг, коэффициенты и их стандартные ошибки
+// идут отдельными столбцами с названиями из result.Terms
+func WriteHistoryCSV(w io.Writer, result PredictionResult) error {
+    header := []string{"day", "window_start", "window_end"}
+    for _, term := range result.Terms {
+        header = append(header, "B["+term+"]")
+    }
+    for _, term := range result.Terms {
+        header = append(header, "SE["+term+"]")
+    }
+    header = append(header, "dad", "f", "f_critical", "decision", "correlation")
+
+    writer := csv.NewWriter(w)
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+    format := func(v float64) string {
+        return strconv.FormatFloat(v, 'g', -1, 64)
+    }
+    for _, step := range result.History {
+        record := []string{strconv.Itoa(step.Day), format(step.WindowStart), format(step.WindowEnd)}
+        for _, b := range step.B {
+            record = append(record, format(b))
+        }
+        for _, se := range step.SE {
+            record = append(record, format(se))
+        }
+        record = append(record, format(step.Dad), format(step.F), format(step.FCritical), step.Decision, format(step.Correlation))
+        if err := writer.Write(record); err != nil {
+            return err
+        }
+    }
+    writer.Flush()
+    return writer.Error()
+}
+
+// WriteHistoryJSON записывает историю моделей в w в формате JSON:
+// названия коэффициентов и массив шагов
+func WriteHistoryJSON(w io.Writer, result PredictionResult) error {
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(struct {
+        Terms   []string    `json:"terms"`
+        History []ModelStep `json:"history"`
+    }{result.Terms, result.History})
+}
+
+// SaveHistory сохраняет историю моделей в файл; формат выбирается по
+// расширению: .csv - CSV, иначе JSON
+func SaveHistory(path string, result PredictionResult) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if strings.HasSuffix(strings.ToLower(path), ".csv") {
+        err = WriteHistoryCSV(file, result)
+    } else {
+        err = WriteHistoryJSON(file, result)
+    }
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return fmt.Errorf("запись истории моделей %s: %w", path, err)
+    }
+    return nil
+}
+
+// Forecaster - потоковый прогнозист по методу скользящей матрицы.
+// Хранит текущее окно наблюдений и модель, обученную на нём; наблюдения
+// поступают по одному через Observe. Не предназначен для одновременного
+// использования из нескольких горутин
+type Forecaster struct {
+    Options    RegressionOptions // Настройки регрессии (схема признаков, интервалы)
+    x          *RingMatrix       // Окно признаков [день, температура]
+    y          *RingMatrix       // Окно целевых значений
+    result     *RegressionResult // Модель текущего окна (nil - требуется переобучение)
+    adaptive   *AdaptiveWindow   // Настройки и состояние адаптивного окна (nil - окно фиксировано)
+    changed    bool              // Последнее наблюдение вызвало сигнал о смене режима
+}
+
+// ForecasterState - снимок состояния прогнозиста для контрольных точек
+type ForecasterState struct {
+    X        Matrix            `json:"x"`                  // Окно признаков
+    Y        Matrix            `json:"y"`                  // Окно целевых значений
+    Options  RegressionOptions `json:"options"`            // Настройки регрессии
+    Adaptive *AdaptiveWindow   `json:"adaptive,omitempty"` // Адаптивное окно (nil - окно фиксировано)
+}
+
+// Методы обнаружения смены режима по ошибкам прогноза
+const (
+    DetectorPageHinkley = "page-hinkley" // Тест Пейджа-Хинкли
+    DetectorCUSUM       = "cusum"        // Двусторонний CUSUM
+)
+
+// ChangeDetector - последовательный детектор смены режима по нормированным
+// ошибкам прогноза zₜ = (yₜ - ŷₜ)/σ̂. Обнаруживает сдвиг среднего ошибок в обе
+// стороны; Delta и Threshold задаются в единицах σ̂
+type ChangeDetector struct {
+    Method    string  `json:"method"`    // Метод (DetectorPageHinkley или DetectorCUSUM; "" - Пейдж-Хинкли)
+    Delta     float64 `json:"delta"`     // Допустимое смещение среднего ошибок (0 - 0.5)
+    Threshold float64 `json:"threshold"` // Порог срабатывания λ (0 - 5)
+
+    Up      float64 `json:"up"`       // Накопленная статистика роста ошибок
+    UpMin   float64 `json:"up_min"`   // Минимум статистики роста (Пейдж-Хинкли)
+    Down    float64 `json:"down"`     // Накопленная статистика снижения ошибок
+    DownMax float64 `json:"down_max"` // Максимум статистики снижения (Пейдж-Хинкли)
+}
+
+// Update учитывает очередную нормированную ошибку z и сообщает, обнаружена ли
+// смена режима. После срабатывания статистики сбрасываются.
+// Пейдж-Хинкли: mₜ = Σ(zᵢ - δ), сигнал при mₜ - min mᵢ > λ (и симметрично
+// для снижения); CUSUM: S⁺ = max(0, S⁺ + z - δ), S⁻ = max(0, S⁻ - z - δ), сигнал при S > λ
+func (d *ChangeDetector) Update(z float64) bool {
+    delta, threshold := d.Delta, d.Threshold
+    if delta == 0 {
+        delta = 0.5
+    }
+    if threshold == 0 {
+        threshold = 5
+    }
+
+    var detected bool
+    switch d.Method {
+    case "", DetectorPageHinkley:
+        d.Up += z - delta
+        d.UpMin = math.Min(d.UpMin, d.Up)
+        d.Down += z + delta
+        d.DownMax = math.Max(d.DownMax, d.Down)
+        detected = d.Up-d.UpMin > threshold || d.DownMax-d.Down > threshold
+    case DetectorCUSUM:
+        d.Up = math.Max(0, d.Up+z-delta)
+        d.Down = math.Max(0, d.Down-z-delta)
+        detected = d.Up > threshold || d.Down > threshold
+    default:
+        panic("Неизвестный метод обнаружения смены режима: " + d.Method)
+    }
+    if detected {
+        d.Reset()
+    }
+    return detected
+}
+
+// Reset сбрасывает накопленные статистики детектора
+func (d *ChangeDetector) Reset() {
+    d.Up, d.UpMin, d.Down, d.DownMax = 0, 0, 0, 0
+}
+
+// AdaptiveWindow - настройки адаптивного скользящего окна: после сигнала
+// детектора окно сокращается до MinSize последних наблюдений, затем снова
+// растет с каждым наблюдением до MaxSize
+type AdaptiveWindow struct {
+    MinSize  int            `json:"min_size"` // Длина окна после смены режима
+    MaxSize  int            `json:"max_size"` // Максимальная длина окна
+    Detector ChangeDetector `json:"detector"` // Детектор смены режима
+}
+
+// NewAdaptiveForecaster создает прогнозист с адаптивным окном: начальное окно
+// initialX, initialY не длиннее adaptive.MaxSize, MinSize должно оставлять
+// наблюдения сверх числа коэффициентов и предыстории лагов
+func NewAdaptiveForecaster(initialX, initialY Matrix, opts RegressionOptions, adaptive AdaptiveWindow) *Forecaster {
+    f := &Forecaster{}
+    f.Restore(ForecasterState{X: initialX, Y: initialY, Options: opts, Adaptive: &adaptive})
+    return f
+}
+
+// Changed сообщает, вызвало ли последнее наблюдение сигнал о смене режима
+// и сокращение адаптивного окна
+func (f *Forecaster) Changed() bool {
+    return f.changed
+}
+
+// NewForecaster создает прогнозист с начальным окном initialX, initialY и настройками opts.
+// Размер окна сохраняется неизменным: каждое новое наблюдение вытесняет самое старое.
+// При лаговых признаках первые MaxLag наблюдений окна служат предысторией лагов,
+// и модель обучается на остальных
+func NewForecaster(initialX, initialY Matrix, opts RegressionOptions) *Forecaster {
+    f := &Forecaster{}
+    f.Restore(ForecasterState{X: initialX, Y: initialY, Options: opts})
+    return f
+}
+
+// Window возвращает копии текущего окна признаков и целевых значений
+func (f *Forecaster) Window() (X, Y Matrix) {
+    return f.x.Matrix(), f.y.Matrix()
+}
+
+// WindowSize возвращает текущее число наблюдений в окне
+func (f *Forecaster) WindowSize() int {
+    return f.x.Len()
+}
+
+// Result возвращает результаты регрессии на текущем окне,
+// переобучая модель, если окно изменилось
+func (f *Forecaster) Result() RegressionResult {
+    if f.result == nil {
+        X, Y := f.Window()
+        result := RunRegressionWithOptions(X, Y, f.Options)
+        f.result = &result
+    }
+    return *f.result
+}
+
+// Model возвращает модель текущего окна в виде, пригодном для сохранения
+func (f *Forecaster) Model() Model {
+    return NewModel(f.Result())
+}
+
+// Predict возвращает прогноз и доверительный интервал для признаков x.
+// Значения лагов берутся из окна наблюдений
+func (f *Forecaster) Predict(x []float64) Forecast {
+    return f.PredictAhead([][]float64{x})[0]
+}
+
+// PredictAhead строит многошаговый прогноз для последовательных дней xs без
+// переобучения модели. Лаги целевой переменной, попадающие на дни прогноза,
+// заменяются прогнозами предыдущих шагов (рекурсивная стратегия); интервалы
+// не учитывают накопление ошибки подставленных прогнозов
+func (f *Forecaster) PredictAhead(xs [][]float64) []Forecast {
+    model := f.Model()
+    X, Y := f.Window()
+    temps, ys := X.Col(1), Y.Col(0)
+
+    forecasts := make([]Forecast, len(xs))
+    for h, x := range xs {
+        if len(x) != f.x.Cols() {
+            panic("Неверное количество признаков для прогноза")
+        }
+        row := append([]float64{}, x...)
+        if model.Design.Lags != nil {
+            row = append(row, model.Design.Lags.Values(temps, ys)...)
+        }
+        forecasts[h] = model.predictAhead(NewMatrix(1, len(row), row), h+1)[0]
+
+        // Прогноз становится предысторией для следующих шагов
+        temps = append(temps, x[1])
+        ys = append(ys, forecasts[h].Y)
+    }
+    return forecasts
+}
+
+// Observe добавляет фактическое наблюдение (x, y) в конец окна
+// и вытесняет самое старое (принцип FIFO - First In First Out).
+// В адаптивном окне ошибка прогноза y передается детектору смены режима;
+// при сигнале окно сокращается до MinSize последних наблюдений.
+// Модель переобучается при следующем обращении к ней
+func (f *Forecaster) Observe(x []float64, y float64) {
+    if len(x) != f.x.Cols() {
+        panic("Неверное количество признаков наблюдения")
+    }
+    f.changed = false
+    if f.adaptive != nil {
+        z := (y - f.Predict(x).Y) / math.Sqrt(f.Result().Dad)
+        f.changed = f.adaptive.Detector.Update(z)
+    }
+    f.x.Push(x)
+    f.y.Push([]float64{y})
+    if f.changed && f.x.Len() > f.adaptive.MinSize {
+        f.x.DropOldest(f.x.Len() - f.adaptive.MinSize)
+        f.y.DropOldest(f.y.Len() - f.adaptive.MinSize)
+    }
+    f.result = nil
+}
+
+// Snapshot возвращает копию текущего состояния прогнозиста
+func (f *Forecaster) Snapshot() ForecasterState {
+    X, Y := f.Window()
+    state := ForecasterState{X: X, Y: Y, Options: f.Options}
+    if f.adaptive != nil {
+        adaptive := *f.adaptive
+        state.Adaptive = &adaptive
+    }
+    return state
+}
+
+// Restore восстанавливает состояние прогнозиста из снимка
+func (f *Forecaster) Restore(state ForecasterState) {
+    if state.X.Rows != state.Y.Rows || state.Y.Cols != 1 {
+        panic("Размеры окна X и Y не согласованы")
+    }
+    f.Options = state.Options.withDefaults()
+    capacity := state.X.Rows
+    f.adaptive = nil
+    if state.Adaptive != nil {
+        adaptive := *state.Adaptive
+        lag := 0
+        if f.Options.Design.Lags != nil {
+            lag = f.Options.Design.Lags.MaxLag()
+        }
+        if adaptive.MinSize <= len(f.Options.Design.termNames())+lag || adaptive.MinSize > adaptive.MaxSize {
+            panic("Минимальная длина адаптивного окна должна превышать число коэффициентов и не превышать максимальную")
+        }
+        if state.X.Rows > adaptive.MaxSize {
+            panic("Начальное окно длиннее максимальной длины адаптивного окна")
+        }
+        capacity = adaptive.MaxSize
+        f.adaptive = &adaptive
+    }
+    f.x = NewRingMatrix(capacity, state.X.Cols)
+    f.y = NewRingMatrix(capacity, 1)
+    for i := 0; i < state.X.Rows; i++ {
+        f.x.Push(state.X.Row(i))
+        f.y.Push(state.Y.Row(i))
+    }
+    f.result = nil
+    f.changed = false
+}
+
+// RollingWindowPrediction реализует прогнозирование с скользящим окном
+// На каждом шаге добавляет новые данные, удаляет старые и перестраивает модель
+// windowSize - размер окна (20 дней в данном случае)
+func RollingWindowPrediction(initialX, initialY, additionalX, additionalY Matrix, windowSize int) PredictionResult {
+    result, _ := RollingWindowPredictionContext(context.Background(), initialX, initialY, additionalX, additionalY, windowSize, DefaultRegressionOptions())
+    return result
+}
+
+// RollingWindowPredictionContext - вариант RollingWindowPrediction с настройками
+// регрессии opts и возможностью отмены через ctx: отмена проверяется перед каждым
+// шагом окна, при отмене возвращаются прогнозы, сделанные до неё, и ошибка ctx.Err()
+func RollingWindowPredictionContext(ctx context.Context, initialX, initialY, additionalX, additionalY Matrix, windowSize int, opts RegressionOptions) (PredictionResult, error) {
+    return rollForecaster(ctx, NewForecaster(initialX, initialY, opts), additionalX, additionalY, windowSize+1)
+}
+
+// AdaptiveWindowPrediction - прогнозирование с адаптивным окном: начальное окно
+// initialX, initialY сокращается после обнаруженной смены режима и растет до
+// adaptive.MaxSize; длины окна по шагам возвращаются в WindowSizes
+func AdaptiveWindowPrediction(ctx context.Context, initialX, initialY, additionalX, additionalY Matrix, adaptive AdaptiveWindow, opts RegressionOptions) (PredictionResult, error) {
+    return rollForecaster(ctx, NewAdaptiveForecaster(initialX, initialY, opts, adaptive), additionalX, additionalY, initialX.Rows+1)
+}
+
+// rollForecaster прогнозирует дни additionalX, начиная с номера firstDay, и
+// после каждого прогноза передает прогнозисту фактическое значение дня
+func rollForecaster(ctx context.Context, forecaster *Forecaster, additionalX, additionalY Matrix, firstDay int) (PredictionResult, error) {
+    predictions := make([]float64, 0)
+    predictionsLow := make([]float64, 0)
+    predictionsHigh := make([]float64, 0)
+    actuals := make([]float64, 0)
+    days := make([]int, 0)
+    history := make([]ModelStep, 0)
+    windowSizes := make([]int, 0)
+    changePoints := make([]int, 0)
+
+    // Последовательная обработка каждого нового дня
+    var err error
+    for i := 0; i < additionalX.Rows; i++ {
+        if err = ctx.Err(); err != nil {
+            break
+        }
+        dayNumber := firstDay + i  // Номер текущего дня (21, 22, ...)
+        actualYVal := additionalY.At(i, 0)
+
+        // Прогноз по модели текущего окна с доверительным интервалом
+        newDayX := []float64{additionalX.At(i, 0), additionalX.At(i, 1)}
+        forecast := forecaster.Predict(newDayX)
+
+        // Модель шага для аудита и контроля дрейфа коэффициентов
+        model := forecaster.Result()
+        windowX, _ := forecaster.Window()
+        history = append(history, ModelStep{
+            Day:         dayNumber,
+            WindowStart: windowX.At(0, 0),
+            WindowEnd:   windowX.At(windowX.Rows-1, 0),
+            B:           append([]float64(nil), model.B.Data...),
+            SE:          append([]float64(nil), model.SE...),
+            Dad:         model.Dad,
+            F:           model.F,
+            FCritical:   model.FCritical,
+            Decision:    model.Decision,
+            Correlation: model.Correlation,
+        })
+
+        // Сохранение результатов прогноза
+        predictions = append(predictions, forecast.Y)
+        predictionsLow = append(predictionsLow, forecast.Low)
+        predictionsHigh = append(predictionsHigh, forecast.High)
+        actuals = append(actuals, actualYVal)
+        days = append(days, dayNumber)
+        windowSizes = append(windowSizes, forecaster.WindowSize())
+
+        // Обновление скользящего окна фактическим значением нового дня
+        forecaster.Observe(newDayX, actualYVal)
+        if forecaster.Changed() {
+            changePoints = append(changePoints, dayNumber)
+        }
+    }
+
+    return PredictionResult{
+        Predictions:     predictions,
+        PredictionsLow:  predictionsLow,
+        PredictionsHigh: predictionsHigh,
+        Actuals:         actuals,
+        Days:            days,
+        Confidence:      forecaster.Options.Confidence,
+        Terms:           forecaster.Options.Design.termNames(),
+        History:         history,
+        WindowSizes:     windowSizes,
+        ChangePoints:    changePoints,
+    }, err
+}
+
+// IntervalEvaluation - оценка калибровки интервалов и вероятностных прогнозов бэктеста
+type IntervalEvaluation struct {
+    NominalCoverage float64   // Номинальная доверительная вероятность интервалов
+    Coverage        float64   // Доля фактических значений внутри интервалов
+    MeanWidth       float64   // Средняя ширина интервала
+    WinklerScore    float64   // Средняя интервальная оценка Винклера (меньше - лучше)
+    CRPS            float64   // Средняя CRPS гауссовского прогнозного распределения (меньше - лучше)
+    PIT             []float64 // Значения PIT: F(yᵢ) прогнозного распределения в фактическом значении
+    PITHistogram    []int     // Гистограмма PIT на равных интервалах [0, 1]
+}
+
+// EvaluateIntervals проверяет калибровку интервалов прогнозов result.
+// Прогнозное распределение считается нормальным со средним, равным точечному
+// прогнозу, и σ = (High - Low) / (2·z), где z - квантиль уровня (1+p)/2 для
+// номинальной вероятности p; для несимметричных (бутстреп) интервалов это
+// приближение. При хорошей калибровке покрытие близко к номинальному, а
+// гистограмма PIT из bins интервалов (bins <= 0 - 10) близка к равномерной
+func EvaluateIntervals(result PredictionResult, bins int) IntervalEvaluation {
+    n := len(result.Actuals)
+    if n == 0 || len(result.Predictions) != n || len(result.PredictionsLow) != n || len(result.PredictionsHigh) != n {
+        panic("Нет прогнозов для оценки или размеры результатов не согласованы")
+    }
+    if result.Confidence <= 0 || result.Confidence >= 1 {
+        panic("Номинальная доверительная вероятность должна быть в интервале (0, 1)")
+    }
+    if bins <= 0 {
+        bins = 10
+    }
+
+    alpha := 1 - result.Confidence
+    z := NormalInv(1 - alpha/2)
+    evaluation := IntervalEvaluation{
+        NominalCoverage: result.Confidence,
+        PIT:             make([]float64, n),
+        PITHistogram:    make([]int, bins),
+    }
+    for i := 0; i < n; i++ {
+        y, low, high := result.Actuals[i], result.PredictionsLow[i], result.PredictionsHigh[i]
+        width := high - low
+
+        // Покрытие и интервальная оценка Винклера: ширина плюс штраф 2/α за выход факта за границу
+        score := width
+        switch {
+        case y < low:
+            score += 2 / alpha * (low - y)
+        case y > high:
+            score += 2 / alpha * (y - high)
+        default:
+            evaluation.Coverage++
+        }
+        evaluation.MeanWidth += width
+        evaluation.WinklerScore += score
+
+        // CRPS и PIT гауссовского прогнозного распределения N(μ, σ²):
+        // CRPS = σ·[u(2Φ(u) - 1) + 2φ(u) - 1/√π], u = (y - μ)/σ.
+        // Интервал нулевой ширины - вырожденное распределение в точке μ:
+        // CRPS = |y - μ|, PIT = 0 при y < μ и 1 иначе
+        mu := result.Predictions[i]
+        var cdf float64
+        if width <= 0 {
+            if y >= mu {
+                cdf = 1
+            }
+            evaluation.CRPS += math.Abs(y - mu)
+        } else {
+            sigma := width / (2 * z)
+            u := (y - mu) / sigma
+            cdf = NormalCDF(u)
+            pdf := math.Exp(-u*u/2) / math.Sqrt(2*math.Pi)
+            evaluation.CRPS += sigma * (u*(2*cdf-1) + 2*pdf - 1/math.Sqrt(math.Pi))
+        }
+        evaluation.PIT[i] = cdf
+        evaluation.PITHistogram[min(int(cdf*float64(bins)), bins-1)]++
+    }
+    evaluation.Coverage /= float64(n)
+    evaluation.MeanWidth /= float64(n)
+    evaluation.WinklerScore /= float64(n)
+    evaluation.CRPS /= float64(n)
+    return evaluation
+}
+
+// QuantileResult - результаты квантильной регрессии для нескольких уровней τ
+type QuantileResult struct {
+    Taus       []float64 // Уровни квантилей τ в порядке возрастания
+    B          Matrix    // Коэффициенты: столбец j - квантиль уровня Taus[j]
+    Design     Design    // Описание расширения признаков, на котором построена модель
+    Iterations []int     // Число итераций IRLS для каждого уровня
+    Loss       []float64 // Средняя pinball-потеря на обучающей выборке для каждого уровня
+}
+
+// Параметры итерационного метода наименьших квадратов для квантильной регрессии
+const (
+    quantileMaxIterations = 200  // Максимальное число итераций IRLS
+    quantileTolerance     = 1e-8 // Относительная точность сходимости коэффициентов
+)
+
+// QuantileRegression оценивает линейную квантильную регрессию Y по матрице плана
+// из opts.Design для каждого уровня τ из taus. Минимизируется сумма pinball-потерь
+// Σρτ(yᵢ - xᵢB) итерационным методом наименьших квадратов (IRLS): на каждой
+// итерации решается взвешенная задача МНК с весами wᵢ = τ/|rᵢ| для rᵢ >= 0 и
+// (1-τ)/|rᵢ| для rᵢ < 0, начиная с оценки МНК
+func QuantileRegression(X, Y Matrix, taus []float64, opts RegressionOptions) QuantileResult {
+    opts = opts.withDefaults()
+    if len(taus) == 0 {
+        panic("Не заданы уровни квантилей")
+    }
+    sorted := append([]float64{}, taus...)
+    sort.Float64s(sorted)
+    for _, tau := range sorted {
+        if tau <= 0 || tau >= 1 {
+            panic("Уровень квантиля должен быть в интервале (0, 1)")
+        }
+    }
+
+    X, Y = opts.Design.Lagged(X, Y)
+    design := opts.Design.Fit(X)
+    augmentedX := design.Apply(X)
+    n, k := augmentedX.Rows, augmentedX.Cols
+
+    // Нижняя граница |rᵢ| в весах, чтобы точки на гиперплоскости не давали деления на ноль.
+    // Масштаб - среднее |yᵢ|, чтобы граница оставалась положительной при отрицательных Y
+    scale := 0.0
+    for _, y := range Y.Data {
+        scale += math.Abs(y)
+    }
+    epsilon := 1e-6 * (1 + scale/float64(n))
+
+    result := QuantileResult{
+        Taus:       sorted,
+        B:          NewMatrix(k, len(sorted), make([]float64, k*len(sorted))),
+        Design:     design,
+        Iterations: make([]int, len(sorted)),
+        Loss:       make([]float64, len(sorted)),
+    }
+    OLS, _ := fitLeastSquares(augmentedX, Y, opts.Standardize)
+    weightedX := NewMatrix(n, k, make([]float64, n*k))
+    weightedY := NewMatrix(n, 1, make([]float64, n))
+    for j, tau := range sorted {
+        B := OLS
+        iteration := 0
+        for iteration < quantileMaxIterations {
+            iteration++
+            for i := 0; i < n; i++ {
+                residual := Y.At(i, 0) - Dot(augmentedX.Row(i), B.Data)
+                weight := tau
+                if residual < 0 {
+                    weight = 1 - tau
+                }
+                weight = math.Sqrt(weight / math.Max(math.Abs(residual), epsilon))
+                for c := 0; c < k; c++ {
+                    weightedX.Set(i, c, weight*augmentedX.At(i, c))
+                }
+                weightedY.Set(i, 0, weight*Y.At(i, 0))
+            }
+            next, _ := fitLeastSquares(weightedX, weightedY, opts.Standardize)
+
+            converged := true
+            for c := 0; c < k; c++ {
+                if math.Abs(next.Data[c]-B.Data[c]) > quantileTolerance*(1+math.Abs(B.Data[c])) {
+                    converged = false
+                }
+            }
+            B = next
+            if converged {
+                break
+            }
+        }
+
+        fitted := Multiply(augmentedX, B)
+        for c := 0; c < k; c++ {
+            result.B.Set(c, j, B.Data[c])
+        }
+        result.Iterations[j] = iteration
+        result.Loss[j] = PinballLoss(Y.Data, fitted.Data, tau)
+    }
+    return result
+}
+
+// Predict возвращает прогнозы квантилей для строк X (строка - наблюдение,
+// столбец - уровень Taus[j]). Пересекающиеся квантили упорядочиваются по
+// возрастанию (перестановка Черножукова), чтобы прогнозы были монотонны по τ
+func (q QuantileResult) Predict(X Matrix) Matrix {
+    predictions := Multiply(q.Design.Apply(X), q.B)
+    for i := 0; i < predictions.Rows; i++ {
+        sort.Float64s(predictions.Row(i))
+    }
+    return predictions
+}
+
+// PinballLoss возвращает среднюю pinball-потерю (квантильную потерю) прогнозов
+// квантиля уровня tau: ρτ(u) = τu при u >= 0 и (τ-1)u при u < 0, где u = y - ŷ
+func PinballLoss(actuals, predictions []float64, tau float64) float64 {
+    if len(actuals) != len(predictions) || len(actuals) == 0 {
+        panic("Размеры фактических значений и прогнозов не совпадают")
+    }
+    sum := 0.0
+    for i := range actuals {
+        u := actuals[i] - predictions[i]
+        if u >= 0 {
+            sum += tau * u
+        } else {
+            sum += (tau - 1) * u
+        }
+    }
+    return sum / float64(len(actuals))
+}
+
+// PredictQuantiles оценивает квантильную регрессию на текущем окне и
+// возвращает прогнозы квантилей уровней taus (по возрастанию) для признаков x
+func (f *Forecaster) PredictQuantiles(x []float64, taus []float64) []float64 {
+    if len(x) != f.x.Cols() {
+        panic("Неверное количество признаков для прогноза")
+    }
+    X, Y := f.Window()
+    quantiles := QuantileRegression(X, Y, taus, f.Options)
+
+    row := append([]float64{}, x...)
+    if f.Options.Design.Lags != nil {
+        row = append(row, f.Options.Design.Lags.Values(X.Col(1), Y.Col(0))...)
+    }
+    return quantiles.Predict(NewMatrix(1, len(row), row)).Row(0)
+}
+
+// QuantilePredictionResult содержит прогнозы квантилей со скользящим окном
+type QuantilePredictionResult struct {
+    Taus      []float64   // Уровни квантилей τ в порядке возрастания
+    Quantiles [][]float64 // Прогнозы квантилей: строка - день, столбец - уровень
+    Actuals   []float64   // Фактические значения для проверки точности
+    Days      []int       // Номера дней, для которых сделан прогноз
+    Pinball   []float64   // Средняя pinball-потеря прогнозов для каждого уровня
+}
+
+// RollingQuantilePrediction строит прогнозы квантилей уровней taus со скользящим
+// окном так же, как RollingWindowPredictionContext строит точечные прогнозы:
+// на каждом шаге квантильная регрессия оценивается заново на текущем окне
+func RollingQuantilePrediction(ctx context.Context, initialX, initialY, additionalX, additionalY Matrix, windowSize int, taus []float64, opts RegressionOptions) (QuantilePredictionResult, error) {
+    forecaster := NewForecaster(initialX, initialY, opts)
+    sorted := append([]float64{}, taus...)
+    sort.Float64s(sorted)
+    result := QuantilePredictionResult{Taus: sorted}
+
+    var err error
+    for i := 0; i < additionalX.Rows; i++ {
+        if err = ctx.Err(); err != nil {
+            break
+        }
+        newDayX := []float64{additionalX.At(i, 0), additionalX.At(i, 1)}
+        result.Quantiles = append(result.Quantiles, forecaster.PredictQuantiles(newDayX, sorted))
+        result.Actuals = append(result.Actuals, additionalY.At(i, 0))
+        result.Days = append(result.Days, windowSize+i+1)
+        forecaster.Observe(newDayX, additionalY.At(i, 0))
+    }
+
+    // Оценка точности прогнозов каждого квантиля
+    if len(result.Actuals) > 0 {
+        result.Pinball = make([]float64, len(sorted))
+        for j, tau := range sorted {
+            predictions := make([]float64, len(result.Quantiles))
+            for i, q := range result.Quantiles {
+                predictions[i] = q[j]
+            }
+            result.Pinball[j] = PinballLoss(result.Actuals, predictions, tau)
+        }
+    }
+    return result, err
+}
+
+// ChowResult - результат теста Чоу на структурный сдвиг в заданной точке
+type ChowResult struct {
+    Break     int     // Номер первого наблюдения второй части выборки
+    F         float64 // F-статистика теста
+    DF1       int     // Степени свободы числителя (число коэффициентов)
+    DF2       int     // Степени свободы знаменателя
+    FCritical float64 // Критическое значение F для уровня значимости 5%
+    PValue    float64 // p-value теста по F-распределению
+    Shift     bool    // Сдвиг значим: PValue < 0.05 (равносильно F > FCritical)
+}
+
+// ChowTest проверяет, различаются ли модели на наблюдениях [0, breakAt) и
+// [breakAt, n): F = ((RSS - RSS₁ - RSS₂)/k) / ((RSS₁ + RSS₂)/(n₁ + n₂ - 2k)),
+// где RSS - остаточная сумма квадратов модели по всей выборке
+func ChowTest(X, Y Matrix, breakAt int, opts RegressionOptions) ChowResult {
+    if breakAt <= 0 || breakAt >= X.Rows {
+        panic("Точка сдвига должна разделять выборку на две непустые части")
+    }
+    pooled := RunRegressionWithOptions(X, Y, opts)
+    first := RunRegressionWithOptions(X.RowsView(0, breakAt), Y.RowsView(0, breakAt), opts)
+    second := RunRegressionWithOptions(X.RowsView(breakAt, X.Rows), Y.RowsView(breakAt, Y.Rows), opts)
+
+    rssPooled := pooled.Dad * float64(pooled.DF)
+    rssParts := first.Dad*float64(first.DF) + second.Dad*float64(second.DF)
+    k := pooled.B.Rows
+    df2 := first.DF + second.DF
+    F := ((rssPooled - rssParts) / float64(k)) / (rssParts / float64(df2))
+    // Точный квантиль (без округленных табличных значений FInv) согласован с p-value
+    pValue := 1 - FCDF(F, k, df2)
+    return ChowResult{Break: breakAt, F: F, DF1: k, DF2: df2, FCritical: fQuantile(0.95, k, df2), PValue: pValue, Shift: pValue < 0.05}
+}
+
+// ChowTests выполняет тест Чоу в каждой точке candidates. Без кандидатов
+// проверяются все точки, при которых в обеих частях остается больше
+// наблюдений, чем коэффициентов модели
+func ChowTests(X, Y Matrix, candidates []int, opts RegressionOptions) []ChowResult {
+    if len(candidates) == 0 {
+        opts = opts.withDefaults()
+        k := len(opts.Design.termNames())
+        lag := 0
+        if opts.Design.Lags != nil {
+            lag = opts.Design.Lags.MaxLag()
+        }
+        for b := lag + k + 1; b <= X.Rows-lag-k-1; b++ {
+            candidates = append(candidates, b)
+        }
+    }
+    results := make([]ChowResult, len(candidates))
+    for i, b := range candidates {
+        results[i] = ChowTest(X, Y, b, opts)
+    }
+    return results
+}
+
+// StabilityResult - CUSUM-тесты устойчивости модели по рекурсивным остаткам
+type StabilityResult struct {
+    RecursiveResiduals []float64 // Рекурсивные остатки wₜ для t = k+1..n
+    CUSUM              []float64 // Накопленные суммы Wᵣ = Σwₜ/σ̂
+    CUSUMBound         []float64 // Граница |Wᵣ| для уровня значимости 5%
+    CUSUMSQ            []float64 // Накопленные доли квадратов Sᵣ = Σwₜ² / Σw²
+    CUSUMSQExpected    []float64 // Ожидаемые значения Sᵣ = (r-k)/(n-k) при устойчивой модели
+    CUSUMSQBound       float64   // Допустимое отклонение |Sᵣ - E(Sᵣ)| для уровня значимости 5%
+    CUSUMBreak         bool      // CUSUM выходит за границу: нестабильны коэффициенты
+    CUSUMSQBreak       bool      // CUSUMSQ выходит за границу: нестабильна дисперсия ошибок
+}
+
+// RecursiveStability вычисляет рекурсивные остатки модели (прогноз наблюдения t
+// по модели на наблюдениях до t, нормированный на √(1 + xₜ(XᵀX)⁻¹xₜᵀ)) и
+// проверяет по ним тесты CUSUM (Браун-Дарбин-Эванс) и CUSUM квадратов
+func RecursiveStability(X, Y Matrix, opts RegressionOptions) StabilityResult {
+    opts = opts.withDefaults()
+    X, Y = opts.Design.Lagged(X, Y)
+    augmentedX := opts.Design.Fit(X).Apply(X)
+    n, k := augmentedX.Rows, augmentedX.Cols
+    if n-k < 3 {
+        panic("Недостаточно наблюдений для рекурсивных остатков")
+    }
+
+    // Рекурсивные остатки по моделям на расширяющихся начальных отрезках
+    w := make([]float64, 0, n-k)
+    for t := k; t < n; t++ {
+        B, XTXInv := fitLeastSquares(augmentedX.RowsView(0, t), Y.RowsView(0, t), opts.Standardize)
+        xt := augmentedX.Row(t)
+        w = append(w, (Y.At(t, 0)-Dot(xt, B.Data))/math.Sqrt(1+QuadForm(xt, XTXInv)))
+    }
+
+    m := float64(len(w))
+    meanW := Mean(w)
+    sumSquares, deviations := 0.0, 0.0
+    for _, v := range w {
+        sumSquares += v * v
+        deviations += (v - meanW) * (v - meanW)
+    }
+    sigma := math.Sqrt(deviations / (m - 1))
+
+    // Границы CUSUM: ±a(√(n-k) + 2(r-k)/√(n-k)), a = 0.948 для уровня 5%;
+    // граница CUSUMSQ - асимптотическое приближение c₀ ≈ 1.358/√((n-k)/2)
+    result := StabilityResult{
+        RecursiveResiduals: w,
+        CUSUMSQBound:       1.358 / math.Sqrt(m/2),
+    }
+    cusum, squares := 0.0, 0.0
+    for r, v := range w {
+        cusum += v / sigma
+        squares += v * v
+        bound := 0.948 * (math.Sqrt(m) + 2*float64(r+1)/math.Sqrt(m))
+        expected := float64(r+1) / m
+        result.CUSUM = append(result.CUSUM, cusum)
+        result.CUSUMBound = append(result.CUSUMBound, bound)
+        result.CUSUMSQ = append(result.CUSUMSQ, squares/sumSquares)
+        result.CUSUMSQExpected = append(result.CUSUMSQExpected, expected)
+        if math.Abs(cusum) > bound {
+            result.CUSUMBreak = true
+        }
+        if math.Abs(squares/sumSquares-expected) > result.CUSUMSQBound {
+            result.CUSUMSQBreak = true
+        }
+    }
+    return result
+}
+
+// DriftAlert - сигнал о дрейфе коэффициента скользящей модели
+type DriftAlert struct {
+    Day    int     // Номер дня, модель которого сместилась
+    Term   string  // Название коэффициента
+    From   float64 // Опорное значение коэффициента
+    To     float64 // Текущее значение коэффициента
+    Change float64 // Смещение в стандартных ошибках опорной модели
+}
+
+// CoefficientDrift просматривает историю моделей result.History и сообщает о
+// коэффициентах, отклонившихся от опорной модели больше чем на threshold ее
+// стандартных ошибок. Опорной служит первая модель; после сигнала опорной
+// становится модель, на которой он получен
+func CoefficientDrift(result PredictionResult, threshold float64) []DriftAlert {
+    var alerts []DriftAlert
+    if len(result.History) == 0 {
+        return alerts
+    }
+    reference := result.History[0]
+    for _, step := range result.History[1:] {
+        drifted := false
+        for j := range step.B {
+            change := (step.B[j] - reference.B[j]) / reference.SE[j]
+            if math.Abs(change) > threshold {
+                alerts = append(alerts, DriftAlert{
+                    Day:    step.Day,
+                    Term:   result.Terms[j],
+                    From:   reference.B[j],
+                    To:     step.B[j],
+                    Change: change,
+                })
+                drifted = true
+            }
+        }
+        if drifted {
+            reference = step
+        }
+    }
+    return alerts
+}
+
+// EnsembleMember - конфигурация участника ансамбля скользящих окон
+type EnsembleMember struct {
+    Name       string            // Название участника для отчета
+    WindowSize int               // Размер окна: последние строки начальной выборки (0 - вся выборка)
+    Options    RegressionOptions // Схема признаков и настройки регрессии
+}
+
+// Способы объединения прогнозов участников ансамбля
+const (
+    CombineEqual        = "equal"         // Равные веса
+    CombineInverseError = "inverse-error" // Веса, обратные среднеквадратичной ошибке прошлых прогнозов
+    CombineStacking     = "stacking"      // Веса на симплексе, минимизирующие ошибку прошлых прогнозов
+)
+
+// EnsembleResult - объединенный прогноз ансамбля и вклад каждого участника
+type EnsembleResult struct {
+    Combined      PredictionResult   // Объединенные прогнозы и интервалы
+    Members       []string           // Названия участников
+    MemberResults []PredictionResult // Прогнозы каждого участника
+    Weights       [][]float64        // Веса участников: строка - день, столбец - участник
+    Contributions [][]float64        // Вклад участников в прогноз (вес·прогноз): строка - день
+}
+
+// EnsemblePrediction прогнозирует дни additionalX несколькими конфигурациями
+// скользящего окна параллельно и объединяет их прогнозы способом combine.
+// Веса дня t вычисляются только по ошибкам участников в предыдущие дни, поэтому
+// объединение не заглядывает в будущее; до первого факта веса равны.
+// Границы объединенного интервала - взвешенные средние границ участников
+func EnsemblePrediction(ctx context.Context, initialX, initialY, additionalX, additionalY Matrix, members []EnsembleMember, combine string) (EnsembleResult, error) {
+    if len(members) == 0 {
+        panic("Ансамбль не содержит участников")
+    }
+    switch combine {
+    case CombineEqual, CombineInverseError, CombineStacking:
+    default:
+        panic("Неизвестный способ объединения ансамбля: " + combine)
+    }
+
+    // Участники независимы и рассчитываются параллельно
+    result := EnsembleResult{
+        Members:       make([]string, len(members)),
+        MemberResults: make([]PredictionResult, len(members)),
+    }
+    errs := make([]error, len(members))
+    var wg sync.WaitGroup
+    for m, member := range members {
+        result.Members[m] = member.Name
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            size := member.WindowSize
+            if size <= 0 || size > initialX.Rows {
+                size = initialX.Rows
+            }
+            start := initialX.Rows - size
+            // Ошибки вычислений (паники) и отмена ctx возвращаются раздельно,
+            // чтобы отмена оставалась распознаваемой через errors.Is
+            var rollErr error
+            err := safeCall(func() {
+                forecaster := NewForecaster(initialX.RowsView(start, initialX.Rows), initialY.RowsView(start, initialY.Rows), member.Options)
+                result.MemberResults[m], rollErr = rollForecaster(ctx, forecaster, additionalX, additionalY, initialX.Rows+1)
+            })
+            if err == nil {
+                err = rollErr
+            }
+            errs[m] = err
+        }()
+    }
+    wg.Wait()
+    for m, err := range errs {
+        if err != nil {
+            return result, fmt.Errorf("участник ансамбля %s: %w", members[m].Name, err)
+        }
+    }
+
+    // Объединение прогнозов по дням с весами по прошлым ошибкам
+    first := result.MemberResults[0]
+    steps := len(first.Days)
+    combined := PredictionResult{Actuals: first.Actuals, Days: first.Days, Confidence: first.Confidence}
+    past := NewMatrix(steps, len(members), make([]float64, steps*len(members)))
+    for t := 0; t < steps; t++ {
+        for m := range members {
+            past.Set(t, m, result.MemberResults[m].Predictions[t])
+        }
+        weights := ensembleWeights(past.RowsView(0, t), first.Actuals[:t], combine)
+
+        var y, low, high float64
+        contributions := make([]float64, len(members))
+        for m, w := range weights {
+            member := result.MemberResults[m]
+            contributions[m] = w * member.Predictions[t]
+            y += contributions[m]
+            low += w * member.PredictionsLow[t]
+            high += w * member.PredictionsHigh[t]
+        }
+        combined.Predictions = append(combined.Predictions, y)
+        combined.PredictionsLow = append(combined.PredictionsLow, low)
+        combined.PredictionsHigh = append(combined.PredictionsHigh, high)
+        result.Weights = append(result.Weights, weights)
+        result.Contributions = append(result.Contributions, contributions)
+    }
+    result.Combined = combined
+    return result, nil
+}
+
+// ensembleWeights возвращает веса участников по их прошлым прогнозам predictions
+// (строка - день, столбец - участник) и фактическим значениям actuals
+func ensembleWeights(predictions Matrix, actuals []float64, combine string) []float64 {
+    M := predictions.Cols
+    weights := make([]float64, M)
+    for m := range weights {
+        weights[m] = 1 / float64(M)
+    }
+    if len(actuals) == 0 || combine == CombineEqual {
+        return weights
+    }
+
+    switch combine {
+    case CombineInverseError:
+        // wₘ ∝ 1/MSEₘ; участник без ошибок получает весь вес
+        total := 0.0
+        for m := 0; m < M; m++ {
+            mse := 0.0
+            for t, y := range actuals {
+                e := y - predictions.At(t, m)
+                mse += e * e
+            }
+            mse /= float64(len(actuals))
+            if mse == 0 {
+                for j := range weights {
+                    weights[j] = 0
+                }
+                weights[m] = 1
+                return weights
+            }
+            weights[m] = 1 / mse
+            total += weights[m]
+        }
+        for m := range weights {
+            weights[m] /= total
+        }
+    case CombineStacking:
+        // Минимизация ||Pw - y||² на симплексе (w >= 0, Σw = 1) проекцией
+        // градиента с шагом 1/L, L - наибольшее собственное значение PᵀP
+        PT := Transpose(predictions)
+        PTP := Multiply(PT, predictions)
+        PTy := Multiply(PT, NewMatrix(len(actuals), 1, actuals))
+        L := SymEigen(PTP).Values[0]
+        if L <= 0 {
+            return weights
+        }
+        for iteration := 0; iteration < 1000; iteration++ {
+            gradient := Sub(Multiply(PTP, NewMatrix(M, 1, weights)), PTy)
+            for m := range weights {
+                weights[m] -= gradient.Data[m] / L
+            }
+            projectSimplex(weights)
+        }
+    }
+    return weights
+}
+
+// projectSimplex проецирует вектор v на симплекс {w >= 0, Σw = 1} (на месте)
+func projectSimplex(v []float64) {
+    sorted := append([]float64{}, v...)
+    sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+    cumulative, theta := 0.0, 0.0
+    for i, u := range sorted {
+        cumulative += u
+        if t := (cumulative - 1) / float64(i+1); u-t > 0 {
+            theta = t
+        }
+    }
+    for i := range v {
+        v[i] = math.Max(v[i]-theta, 0)
+    }
+}
+
+// Методы базовых прогнозов для сравнения со скользящей матрицей
+const (
+    BaselineNaive         = "naive"          // Значение предыдущего дня
+    BaselineSeasonalNaive = "seasonal-naive" // Значение того же дня прошлого сезона (недели)
+    BaselineMovingAverage = "moving-average" // Среднее последних Window дней
+    BaselineSES           = "ses"            // Простое экспоненциальное сглаживание
+    BaselineHoltWinters   = "holt-winters"   // Аддитивная модель Холта-Уинтерса
+)
+
+// Baseline - базовый метод прогноза по истории целевой переменной. Нулевые
+// параметры заменяются значениями по умолчанию: Season = 7, Window = 7,
+// Alpha = 0.3, Beta = 0.1, Gamma = 0.1, Confidence = 0.95
+type Baseline struct {
+    Method     string  // Метод (BaselineNaive, BaselineSeasonalNaive, ...)
+    Season     int     // Длина сезона в днях
+    Window     int     // Число дней скользящего среднего
+    Alpha      float64 // Параметр сглаживания уровня
+    Beta       float64 // Параметр сглаживания тренда (Холт-Уинтерс)
+    Gamma      float64 // Параметр сглаживания сезонности (Холт-Уинтерс)
+    Confidence float64 // Доверительная вероятность интервалов
+}
+
+// withDefaults возвращает копию параметров с заполненными значениями по умолчанию
+func (b Baseline) withDefaults() Baseline {
+    if b.Season == 0 {
+        b.Season = 7
+    }
+    if b.Window == 0 {
+        b.Window = 7
+    }
+    if b.Alpha == 0 {
+        b.Alpha = 0.3
+    }
+    if b.Beta == 0 {
+        b.Beta = 0.1
+    }
+    if b.Gamma == 0 {
+        b.Gamma = 0.1
+    }
+    if b.Confidence == 0 {
+        b.Confidence = 0.95
+    }
+    return b
+}
+
+// oneStep прогоняет метод по истории history и возвращает прогнозы на шаг
+// вперед для каждого дня истории (NaN, если метод еще не может дать прогноз)
+// и прогноз следующего за историей дня
+func (b Baseline) oneStep(history []float64) ([]float64, float64) {
+    n := len(history)
+    fitted := make([]float64, n)
+    for t := range fitted {
+        fitted[t] = math.NaN()
+    }
+
+    switch b.Method {
+    case BaselineNaive, BaselineSeasonalNaive, BaselineMovingAverage:
+        lag, window := 1, 1
+        switch b.Method {
+        case BaselineSeasonalNaive:
+            lag = b.Season
+        case BaselineMovingAverage:
+            window = b.Window
+        }
+        if n < lag+window-1 {
+            panic("Недостаточно истории для базового прогноза " + b.Method)
+        }
+        // Прогноз дня t - среднее window значений, заканчивающихся днем t-lag
+        forecast := func(t int) float64 {
+            return Mean(history[t-lag-window+1 : t-lag+1])
+        }
+        for t := lag + window - 1; t < n; t++ {
+            fitted[t] = forecast(t)
+        }
+        return fitted, forecast(n)
+    case BaselineSES:
+        level := history[0]
+        for t := 1; t < n; t++ {
+            fitted[t] = level
+            level = b.Alpha*history[t] + (1-b.Alpha)*level
+        }
+        return fitted, level
+    case BaselineHoltWinters:
+        // Начальные уровень, тренд и сезонность по первым двум сезонам
+        s := b.Season
+        if n < 2*s {
+            panic("Для модели Холта-Уинтерса нужна история не короче двух сезонов")
+        }
+        level := Mean(history[:s])
+        trend := (Mean(history[s:2*s]) - level) / float64(s)
+        seasonal := make([]float64, s)
+        for i := 0; i < s; i++ {
+            seasonal[i] = history[i] - level
+        }
+        for t := s; t < n; t++ {
+            fitted[t] = level + trend + seasonal[t%s]
+            previous := level
+            level = b.Alpha*(history[t]-seasonal[t%s]) + (1-b.Alpha)*(level+trend)
+            trend = b.Beta*(level-previous) + (1-b.Beta)*trend
+            seasonal[t%s] = b.Gamma*(history[t]-level) + (1-b.Gamma)*seasonal[t%s]
+        }
+        return fitted, level + trend + seasonal[n%s]
+    default:
+        panic("Неизвестный базовый метод: " + b.Method)
+    }
+}
+
+// Forecast возвращает прогноз дня, следующего за историей history, с интервалом
+// y ± z·σ, где σ - среднеквадратичная ошибка прогнозов метода на шаг вперед
+// по той же истории, z - квантиль нормального распределения
+func (b Baseline) Forecast(history []float64) Forecast {
+    b = b.withDefaults()
+    fitted, y := b.oneStep(history)
+    sumSquares, count := 0.0, 0
+    for t, f := range fitted {
+        if !math.IsNaN(f) {
+            sumSquares += (history[t] - f) * (history[t] - f)
+            count++
+        }
+    }
+    if count == 0 {
+        panic("Недостаточно истории для оценки ошибки базового прогноза " + b.Method)
+    }
+    halfWidth := NormalInv((1+b.Confidence)/2) * math.Sqrt(sumSquares/float64(count))
+    return Forecast{Y: y, Low: y - halfWidth, High: y + halfWidth}
+}
+
+// RollingBaselinePrediction выполняет бэктест базового метода по той же схеме,
+// что и RollingWindowPredictionContext: прогноз каждого дня additionalY строится
+// по окну последних windowSize фактических значений, затем окно сдвигается
+func RollingBaselinePrediction(ctx context.Context, initialY, additionalY Matrix, windowSize int, baseline Baseline) (PredictionResult, error) {
+    baseline = baseline.withDefaults()
+    window := NewRingMatrix(windowSize, 1)
+    for i := 0; i < initialY.Rows; i++ {
+        window.Push(initialY.Row(i))
+    }
+
+    result := PredictionResult{Confidence: baseline.Confidence}
+    var err error
+    for i := 0; i < additionalY.Rows; i++ {
+        if err = ctx.Err(); err != nil {
+            break
+        }
+        forecast := baseline.Forecast(window.Matrix().Data)
+        result.Predictions = append(result.Predictions, forecast.Y)
+        result.PredictionsLow = append(result.PredictionsLow, forecast.Low)
+        result.PredictionsHigh = append(result.PredictionsHigh, forecast.High)
+        result.Actuals = append(result.Actuals, additionalY.At(i, 0))
+        result.Days = append(result.Days, windowSize+i+1)
+        result.WindowSizes = append(result.WindowSizes, window.Len())
+        window.Push(additionalY.Row(i))
+    }
+    return result, err
+}
+
+// ForecastMetrics - показатели точности точечных прогнозов бэктеста
+type ForecastMetrics struct {
+    MAE  float64 // Средняя абсолютная ошибка
+    RMSE float64 // Корень из средней квадратичной ошибки
+    MAPE float64 // Средняя абсолютная процентная ошибка, %
+    Bias float64 // Среднее смещение прогноза (прогноз - факт)
+}
+
+// EvaluateForecasts вычисляет показатели точности прогнозов result
+func EvaluateForecasts(result PredictionResult) ForecastMetrics {
+    n := len(result.Actuals)
+    if n == 0 || len(result.Predictions) != n {
+        panic("Нет прогнозов для оценки или размеры результатов не согласованы")
+    }
+    var metrics ForecastMetrics
+    for i, actual := range result.Actuals {
+        error := result.Predictions[i] - actual
+        metrics.MAE += math.Abs(error)
+        metrics.RMSE += error * error
+        metrics.MAPE += math.Abs(error / actual)
+        metrics.Bias += error
+    }
+    metrics.MAE /= float64(n)
+    metrics.RMSE = math.Sqrt(metrics.RMSE / float64(n))
+    metrics.MAPE *= 100 / float64(n)
+    metrics.Bias /= float64(n)
+    return metrics
+}
+
+// Функции потерь для сравнения точности прогнозов
+const (
+    LossSquared  = "squared"  // Квадрат ошибки
+    LossAbsolute = "absolute" // Модуль ошибки
+)
+
+// DieboldMarianoResult - результат теста Диболда-Мариано о равной точности прогнозов
+type DieboldMarianoResult struct {
+    MeanDifference float64 // Средняя разность потерь d̄ = mean(L(e₁) - L(e₂)); < 0 - первый точнее
+    Statistic      float64 // Статистика DM = d̄/√(V(d̄)), асимптотически N(0, 1)
+    PValueNormal   float64 // Двусторонний p-value DM по нормальному распределению
+    HLN            float64 // Статистика с поправкой Харви-Лейборна-Ньюболда
+    PValue         float64 // Двусторонний p-value HLN по t-распределению с n-1 степенями свободы
+    N              int     // Число сравниваемых прогнозов
+    Horizon        int     // Горизонт прогноза h
+}
+
+// DieboldMariano проверяет гипотезу о равной точности прогнозов first и second
+// одних и тех же фактических значений при функции потерь loss. Дисперсия
+// средней разности потерь оценивается с автоковариациями до лага h-1
+// (h - горизонт прогноза, 1 для прогнозов на день вперед); маловыборочная
+// поправка Харви умножает статистику на √((n + 1 - 2h + h(h-1)/n)/n).
+// При совпадающих потерях статистики равны 0, а p-value - 1
+func DieboldMariano(first, second PredictionResult, loss string, horizon int) DieboldMarianoResult {
+    n := len(first.Actuals)
+    if n < 2 || len(second.Actuals) != n || len(first.Predictions) != n || len(second.Predictions) != n {
+        panic("Для теста Диболда-Мариано нужны прогнозы одних и тех же дней")
+    }
+    for i := range first.Actuals {
+        if first.Actuals[i] != second.Actuals[i] {
+            panic("Фактические значения сравниваемых прогнозов не совпадают")
+        }
+    }
+    if horizon <= 0 || horizon >= n {
+        panic("Горизонт прогноза должен быть от 1 до n-1")
+    }
+    lossOf := func(e float64) float64 {
+        switch loss {
+        case LossSquared:
+            return e * e
+        case LossAbsolute:
+            return math.Abs(e)
+        default:
+            panic("Неизвестная функция потерь: " + loss)
+        }
+    }
+
+    d := make([]float64, n)
+    for i := range d {
+        d[i] = lossOf(first.Actuals[i]-first.Predictions[i]) - lossOf(second.Actuals[i]-second.Predictions[i])
+    }
+    meanD := Mean(d)
+    autocovariance := func(k int) float64 {
+        sum := 0.0
+        for t := k; t < n; t++ {
+            sum += (d[t] - meanD) * (d[t-k] - meanD)
+        }
+        return sum / float64(n)
+    }
+    variance := autocovariance(0)
+    for k := 1; k < horizon; k++ {
+        variance += 2 * autocovariance(k)
+    }
+    // Отрицательная оценка с автоковариациями заменяется дисперсией
+    if variance <= 0 {
+        variance = autocovariance(0)
+    }
+    // Одинаковые потери: различий в точности нет (вместо 0/0)
+    if variance == 0 && meanD == 0 {
+        return DieboldMarianoResult{PValueNormal: 1, PValue: 1, N: n, Horizon: horizon}
+    }
+    if variance == 0 {
+        panic("Разности потерь постоянны: тест Диболда-Мариано неприменим")
+    }
+
+    h := float64(horizon)
+    statistic := meanD / math.Sqrt(variance/float64(n))
+    hln := statistic * math.Sqrt((float64(n)+1-2*h+h*(h-1)/float64(n))/float64(n))
+    return DieboldMarianoResult{
+        MeanDifference: meanD,
+        Statistic:      statistic,
+        PValueNormal:   2 * (1 - NormalCDF(math.Abs(statistic))),
+        HLN:            hln,
+        PValue:         2 * (1 - TCDF(math.Abs(hln), n-1)),
+        N:              n,
+        Horizon:        horizon,
+    }
+}
+
+// Series - независимый временной ряд одного фидера или объекта для пакетного расчета
+type Series struct {
+    ID          string            // Идентификатор ряда (фидер, подстанция, объект)
+    InitialX    Matrix            // Начальное окно признаков [день, температура]
+    InitialY    Matrix            // Начальное окно целевых значений
+    AdditionalX Matrix            // Признаки дней для прогноза со сдвигом окна
+    AdditionalY Matrix            // Фактические значения дней для прогноза
+    WindowSize  int               // Размер окна
+    Options     RegressionOptions // Настройки регрессии (нулевое значение - исходная модель)
+}
+
+// SeriesResult - результат расчета одного ряда в пакетном режиме
+type SeriesResult struct {
+    ID         string           // Идентификатор ряда
+    Initial    RegressionResult // Регрессия на начальном окне
+    Prediction PredictionResult // Прогнозы со скользящим окном
+    Err        error            // Ошибка расчета или отмены (nil - успешно)
+}
+
+// RunBatch рассчитывает модели скользящей матрицы для множества независимых рядов
+// параллельно пулом из workers горутин (workers <= 0 - по числу процессоров).
+// Результаты возвращаются в порядке входных рядов; ошибка одного ряда не
+// прерывает остальные. При отмене ctx необработанные ряды получают ошибку ctx.Err()
+func RunBatch(ctx context.Context, series []Series, workers int) []SeriesResult {
+    if workers <= 0 {
+        workers = runtime.GOMAXPROCS(0)
+    }
+    if workers > len(series) {
+        workers = len(series)
+    }
 
-        for j := 0; j < 2*n; j++ {
-            augmented.Set(i, j, augmented.At(i, j)/pivot)
-        }
+    results := make([]SeriesResult, len(series))
+    jobs := make(chan int)
+    var wg sync.WaitGroup
 
-        // Исключение - обнуление элементов в текущем столбце других строк
-        for k := 0; k < n; k++ {
-            if k != i {
-                factor := augmented.At(k, i)
-                for j := 0; j < 2*n; j++ {
-                    augmented.Set(k, j, augmented.At(k, j)-factor*augmented.At(i, j))
-                }
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range jobs {
+                results[i] = runSeries(ctx, series[i])
             }
-        }
+        }()
     }
 
-    // Извлекаем обратную матрицу из правой части расширенной матрицы
-    result := NewMatrix(n, n, make([]float64, n*n))
-    for i := 0; i < n; i++ {
-        for j := 0; j < n; j++ {
-            result.Set(i, j, augmented.At(i, j+n))
+    // Раздача заданий; после отмены оставшиеся ряды помечаются ошибкой
+    for i := range series {
+        select {
+        case jobs <- i:
+        case <-ctx.Done():
+            results[i] = SeriesResult{ID: series[i].ID, Err: ctx.Err()}
         }
     }
+    close(jobs)
+    wg.Wait()
 
-    return result
+    return results
 }
 
-// Mean вычисляет среднее арифметическое значение массива
-func Mean(data []float64) float64 {
-    sum := 0.0
-    for _, v := range data {
-        sum += v
+// runSeries рассчитывает один ряд, превращая панику вычислений в ошибку
+func runSeries(ctx context.Context, s Series) SeriesResult {
+    result := SeriesResult{ID: s.ID}
+    if err := ctx.Err(); err != nil {
+        result.Err = err
+        return result
     }
-    return sum / float64(len(data))
+    err := safeCall(func() {
+        result.Initial = RunRegressionWithOptions(s.InitialX, s.InitialY, s.Options)
+        var err error
+        result.Prediction, err = RollingWindowPredictionContext(ctx, s.InitialX, s.InitialY, s.AdditionalX, s.AdditionalY, s.WindowSize, s.Options)
+        result.Err = err
+    })
+    if err != nil {
+        result.Err = fmt.Errorf("ряд %s: %w", s.ID, err)
+    }
+    return result
 }
 
-// Augment дополняет матрицу независимых переменных для полиномиальной регрессии 2-го порядка
-// Преобразует матрицу X [день, температура] в расширенную матрицу с признаками:
-// [1, X1, X1², X3, X1*X3] где X1 - номер дня, X3 - температура
-func Augment(X Matrix) Matrix {
-    N := X.Rows
-    augmentedData := make([]float64, N*5)
-
-    for i := 0; i < N; i++ {
-        augmentedData[i*5+0] = 1                          // Константа (свободный член модели)
-        augmentedData[i*5+1] = X.At(i, 0)                 // X1 (номер дня - линейный эффект)
-        augmentedData[i*5+2] = X.At(i, 0) * X.At(i, 0)   // X1² (квадрат номера дня - нелинейный эффект)
-        augmentedData[i*5+3] = X.At(i, 1)                 // X3 (температура - линейный эффект)
-        augmentedData[i*5+4] = X.At(i, 0) * X.At(i, 1)   // X1*X3 (взаимодействие дня и температуры)
-    }
+// ForecastServer - встраиваемый HTTP-сервис прогнозирования.
+// Хранит текущую модель и прогнозист со скользящим окном обучающих данных;
+// все запросы и ответы передаются в формате JSON
+type ForecastServer struct {
+    Options    RegressionOptions // Настройки регрессии для моделей, обучаемых через /fit
+    mu         sync.Mutex
+    model      *Model            // Текущая модель (обученная или загруженная)
+    forecaster *Forecaster       // Прогнозист со скользящим окном (нет у загруженной модели)
+}
 
-    return NewMatrix(N, 5, augmentedData)
+// Diagnostics - сводка о текущей модели, которую возвращает сервис
+type Diagnostics struct {
+    Terms       []string  `json:"terms"`                 // Названия признаков
+    B           []float64 `json:"b"`                     // Коэффициенты регрессии
+    Dad         float64   `json:"dad"`                   // Остаточная дисперсия
+    DF          int       `json:"df"`                    // Степени свободы остатков
+    Correlation *float64  `json:"correlation,omitempty"` // Коэффициент корреляции Y и YR
+    Decision    string    `json:"decision,omitempty"`    // Решение об адекватности модели
+    WindowSize  int       `json:"window_size"`           // Размер скользящего окна (0 - окна нет)
 }
 
-// RegressionResult содержит полные результаты регрессионного анализа
-type RegressionResult struct {
-    YR[] float64 // Расчетные значения зависимой переменной Y
-    B  Matrix // Коэффициенты регрессии [B0, B1, B2, B3, B4]
-    YConfLow []float64 // Нижние границы 95% доверительных интервалов для Y
-    YConfHigh []float64 // Верхние границы 95% доверительных интервалов для Y
-    Correlation float64 // Коэффициент корреляции между Y и YR
-    Decision string // Решение об адекватности модели ("Адекватна"/"Неадекватна")
+// fitRequest - обучающая выборка: строки [день, температура] и значения Y
+type fitRequest struct {
+    X [][]float64 `json:"x"`
+    Y []float64   `json:"y"`
 }
 
-// RunRegression выполняет полный регрессионный анализ по методу наименьших квадратов
-// Возвращает коэффициенты модели, прогнозы и статистики качества
-func RunRegression(X, Y Matrix) RegressionResult {
-    // 1. Расширение матрицы признаков для полиномиальной регрессии
-    augmentedX := Augment(X)
+// predictRequest - строки [день, температура], для которых нужен прогноз
+type predictRequest struct {
+    X [][]float64 `json:"x"`
+}
 
-    // 2. Расчет коэффициентов регрессии: B = (XᵀX)⁻¹XᵀY
-    XT := Transpose(augmentedX)
-    XTX := Multiply(XT, augmentedX)
-    XTXInv := Inverse(XTX)
-    XTY := Multiply(XT, Y)
-    B := Multiply(XTXInv, XTY)
+// observeRequest - новое фактическое наблюдение для сдвига окна
+type observeRequest struct {
+    X []float64 `json:"x"`
+    Y float64   `json:"y"`
+}
 
-    // 3. Расчет прогнозных значений YR = X * B
-    YRMatrix := Multiply(augmentedX, B)
-    YR := make([]float64, Y.Rows)
-    for i := 0; i < Y.Rows; i++ {
-        YR[i] = YRMatrix.At(i, 0)
-    }
+// errNoModel возвращается, пока в сервис не загружена и не обучена модель
+var errNoModel = errors.New("модель не задана: выполните /fit или загрузите /model")
 
-    // 4. Проверка адекватности модели по F-критерию Фишера
-    N := augmentedX.Rows // Количество наблюдений
-    k := augmentedX.Cols // Количество параметров модели (5)
+// NewForecastServer создает сервис без модели; модели /fit обучаются с настройками opts
+func NewForecastServer(opts RegressionOptions) *ForecastServer {
+    return &ForecastServer{Options: opts}
+}
 
-    // Дисперсия адекватности (остаточная дисперсия)
-    sumSquaredErrors := 0.0
-    for i := 0; i < N; i++ {
-        error := Y.At(i, 0) - YR[i]
-        sumSquaredErrors += error * error
-    }
-    Dad := sumSquaredErrors / float64(N-k)
+// Handler возвращает маршрутизатор с эндпоинтами сервиса:
+//   POST /fit         - обучить модель по выборке и запомнить её как окно
+//   GET  /model       - выгрузить текущую модель
+//   PUT  /model       - загрузить ранее сохраненную модель (без окна)
+//   POST /predict     - прогноз и доверительные интервалы для строк X
+//   POST /observe     - добавить фактическое наблюдение и сдвинуть окно
+//   GET  /diagnostics - диагностика текущей модели
+func (s *ForecastServer) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("POST /fit", s.handleFit)
+    mux.HandleFunc("GET /model", s.handleGetModel)
+    mux.HandleFunc("PUT /model", s.handlePutModel)
+    mux.HandleFunc("POST /predict", s.handlePredict)
+    mux.HandleFunc("POST /observe", s.handleObserve)
+    mux.HandleFunc("GET /diagnostics", s.handleDiagnostics)
+    return mux
+}
 
-    // Общая дисперсия зависимой переменной
-    YSR := Mean(Y.Data)
-    totalSumSquares := 0.0
-    for i := 0; i < N; i++ {
-        totalSumSquares += (Y.At(i, 0) - YSR) * (Y.At(i, 0) - YSR)
+// Fit обучает модель на выборке X, Y и делает её текущим скользящим окном
+func (s *ForecastServer) Fit(X, Y Matrix) error {
+    var forecaster *Forecaster
+    var model Model
+    err := safeCall(func() {
+        forecaster = NewForecaster(X, Y, s.Options)
+        model = forecaster.Model()
+    })
+    if err != nil {
+        return err
     }
-    DY := totalSumSquares / float64(N-1)
-
-    // F-статистика: отношение объясненной дисперсии к остаточной
-    FR := DY / Dad
 
-    // Критическое значение F-распределения для уровня значимости 5%
-    alpha := 0.05
-    df1 := k - 1  // Степени свободы числителя
-    df2 := N - k  // Степени свободы знаменателя
-    Fcritical := FInv(alpha, df1, df2)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.model = &model
+    s.forecaster = forecaster
+    return nil
+}
 
-    // Коэффициент корреляции между фактическими и расчетными значениями
-    correlation := Correlation(Y.Data, YR)
+// Observe добавляет фактическое наблюдение в окно прогнозиста и переобучает
+// модель; при ошибке переобучения состояние окна не меняется
+func (s *ForecastServer) Observe(x []float64, y float64) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
 
-    // Проверка адекватности: если F > Fкрит, модель адекватна
-    decision := "Неадекватна"
-    if FR > Fcritical {
-        decision = "Адекватна"
+    if s.model == nil {
+        return errNoModel
     }
-
-    fmt.Printf("Модель %s. Коэффициент корреляции: %.4f\n", decision, correlation)
-
-    // 5. Расчет доверительных интервалов для прогнозных значений
-    G := XTXInv // Матрица ковариаций коэффициентов (XᵀX)⁻¹
-    df := N - k // Степени свободы
-    confidence := 0.95
-    tValue := TInv((1+confidence)/2, df) // Критическое значение t-статистики
-
-    YConfLow := make([]float64, N)
-    YConfHigh := make([]float64, N)
-
-    for i := 0; i < N; i++ {
-       
- // Вектор признаков для i-го наблюдения
-        xi := make([]float64, 5)
-        for j := 0; j < 5; j++ {
-            xi[j] = augmentedX.At(i, j)
-        }
-
-        // Дисперсия прогноза: Var(ŷ) = σ² * xᵢ(XᵀX)⁻¹xᵢᵀ
-        var seSquared float64
-        for j := 0; j < 5; j++ {
-            for l := 0; l < 5; l++ {
-                seSquared += xi[j] * G.At(j, l) * xi[l]
-            }
-        }
-        SE_YR := math.Sqrt(seSquared * Dad) // Стандартная ошибка прогноза
-
-        // Доверительный интервал: ŷ ± t(α/2, df) * SE(ŷ)
-        YConfLow[i] = YR[i] - tValue*SE_YR
-        YConfHigh[i] = YR[i] + tValue*SE_YR
+    if s.forecaster == nil {
+        return errors.New("у загруженной модели нет окна данных: выполните /fit")
     }
 
-    return RegressionResult{
-        YR:          YR,
-        B:           B,
-        YConfLow:    YConfLow,
-        YConfHigh:   YConfHigh,
-        Correlation: correlation,
-        Decision:    decision,
+    snapshot := s.forecaster.Snapshot()
+    var model Model
+    err := safeCall(func() {
+        s.forecaster.Observe(x, y)
+        model = s.forecaster.Model()
+    })
+    if err != nil {
+        s.forecaster.Restore(snapshot)
+        return err
     }
+    s.model = &model
+    return nil
 }
 
-// PredictionResult содержит результаты прогнозирования на новых данных
-type PredictionResult struct {
-    Predictions     []float64 // Точечные прогнозы для новых наблюдений
-    PredictionsLow  []float64 // Нижние границы доверительных интервалов
-    PredictionsHigh []float64 // Верхние границы доверительных интервалов
-    Actuals         []float64 // Фактические значения для проверки точности
-    Days            []int     // Номера дней, для которых сделан прогноз
+// SetModel заменяет текущую модель загруженной; окно данных сбрасывается
+func (s *ForecastServer) SetModel(m Model) error {
+    if err := m.Validate(); err != nil {
+        return err
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.model = &m
+    s.forecaster = nil
+    return nil
 }
 
-// RollingWindowPrediction реализует прогнозирование с скользящим окном
-// На каждом шаге добавляет новые данные, удаляет старые и перестраивает модель
-// windowSize - размер окна (20 дней в данном случае)
-func RollingWindowPrediction(initialX, initialY, additionalX, additionalY Matrix, windowSize int) PredictionResult {
-    XWindow := initialX // Текущее окно признаков
-    YWindow := initialY // Текущее окно целевых значений
+// Diagnostics возвращает сводку о текущей модели
+func (s *ForecastServer) Diagnostics() (Diagnostics, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
 
-    predictions := make([]float64, 0)
-    predictionsLow := make([]float64, 0)
-    predictionsHigh := make([]float64, 0)
-    actuals := make([]float64, 0)
-    days := make([]int, 0)
+    if s.model == nil {
+        return Diagnostics{}, errNoModel
+    }
+    d := Diagnostics{
+        Terms: s.model.Design.Terms,
+        B:     s.model.B,
+        Dad:   s.model.Dad,
+        DF:    s.model.DF,
+    }
+    if s.forecaster != nil {
+        result := s.forecaster.Result()
+        d.Correlation = &result.Correlation
+        d.Decision = result.Decision
+        d.WindowSize = s.forecaster.WindowSize()
+    }
+    return d, nil
+}
 
-    // Последовательная обработка каждого нового дня
-    for i := 0; i < additionalX.Rows; i++ {
-        dayNumber := windowSize + i + 1  // Номер текущего дня (21, 22, ...)
-        temperature := additionalX.At(i, 1)
-        actualYVal := additionalY.At(i, 0)
+func (s *ForecastServer) handleFit(w http.ResponseWriter, r *http.Request) {
+    var req fitRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    X, err := matrixFromRows(req.X)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if len(req.Y) != X.Rows {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("число значений Y (%d) не совпадает с числом строк X (%d)", len(req.Y), X.Rows))
+        return
+    }
+    if err := s.Fit(X, NewMatrix(len(req.Y), 1, req.Y)); err != nil {
+        writeError(w, http.StatusUnprocessableEntity, err)
+        return
+    }
+    s.handleDiagnostics(w, r)
+}
 
-        // Обучение модели на текущем скользящем окне
-        result := RunRegression(XWindow, YWindow)
+func (s *ForecastServer) handleGetModel(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    model := s.model
+    s.mu.Unlock()
 
-        // Подготовка данных нового дня для прогноза
-        newDayX := NewMatrix(1, 2, []float64{
-            additionalX.At(i, 0), additionalX.At(i, 1),
-        })
-        augmentedNewX := Augment(newDayX)
+    if model == nil {
+        writeError(w, http.StatusNotFound, errNoModel)
+        return
+    }
+    writeJSON(w, http.StatusOK, model)
+}
 
-        // Точечный прогноз: ŷ = X_new * B
-        YPredMatrix := Multiply(augmentedNewX, result.B)
-        predictedY := YPredMatrix.At(0, 0)
+func (s *ForecastServer) handlePutModel(w http.ResponseWriter, r *http.Request) {
+    var m Model
+    if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if err := s.SetModel(m); err != nil {
+        writeError(w, http.StatusUnprocessableEntity, err)
+        return
+    }
+    s.handleDiagnostics(w, r)
+}
 
-        // Расчет доверительного интервала для прогноза нового наблюдения
-        XTaugmented := Augment(XWindow)
-        G := Inverse(Multiply(Transpose(XTaugmented), XTaugmented))
+func (s *ForecastServer) handlePredict(w http.ResponseWriter, r *http.Request) {
+    var req predictRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    X, err := matrixFromRows(req.X)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
 
-        // Оценка дисперсии ошибки на текущем окне
-        sumSquaredErrors := 0.0
-        for j := 0; j < YWindow.Rows; j++ {
-            YRj := Multiply(XTaugmented, result.B).At(j, 0)
-            error := YWindow.At(j, 0) - YRj
-            sumSquaredErrors += error * error
-        }
-        Dad := sumSquaredErrors / float64(YWindow.Rows-XTaugmented.Cols)
+    s.mu.Lock()
+    model := s.model
+    s.mu.Unlock()
 
-        // Стандартная ошибка прогноза для нового наблюдения
-        xi := make([]float64, 5)
-        for j := 0; j < 5; j++ {
-            xi[j] = augmentedNewX.At(0, j)
-        }
+    if model == nil {
+        writeError(w, http.StatusNotFound, errNoModel)
+        return
+    }
+    if X.Cols != model.Design.InputCols() {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("строки X должны содержать [день, температура] и значения лагов %v", model.Design.Terms))
+        return
+    }
+    var forecasts []Forecast
+    if err := safeCall(func() { forecasts = model.Predict(X) }); err != nil {
+        writeError(w, http.StatusUnprocessableEntity, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string][]Forecast{"forecasts": forecasts})
+}
 
-        var seSquared float64
-        for j := 0; j < 5; j++ {
-            for l := 0; l < 5; l++ {
-                seSquared += xi[j] * G.At(j, l) * xi[l]
-            }
+func (s *ForecastServer) handleObserve(w http.ResponseWriter, r *http.Request) {
+    var req observeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if err := s.Observe(req.X, req.Y); err != nil {
+        status := http.StatusUnprocessableEntity
+        if errors.Is(err, errNoModel) {
+            status = http.StatusNotFound
         }
-        SEPred := math.Sqrt(seSquared * Dad)
-
-        confidence := 0.95
-        tValue := TInv((1+confidence)/2, YWindow.Rows-XTaugmented.Cols)
-
-        // Границы доверительного интервала прогноза
-        YPredLow := predictedY - tValue*SEPred
-        YPredHigh := predictedY + tValue*SEPred
-
-        // Сохранение результатов прогноза
-        predictions = append(predictions, predictedY)
-        predictionsLow = append(predictionsLow, YPredLow)
-        predictionsHigh = append(predictionsHigh, YPredHigh)
-        actuals = append(actuals, actualYVal)
-        days = append(days, dayNumber)
-
-        fmt.Printf("День %d: Температура = %.2f, Фактическое Y = %.2f, Прогнозное Y = %.2f\n",
-            dayNumber, temperature, actualYVal, predictedY)
+        writeError(w, status, err)
+        return
+    }
+    s.handleDiagnostics(w, r)
+}
 
-        // Обновление скользящего окна: удаление самого старого наблюдения,
-        // добавление нового (принцип FIFO - First In First Out)
-        newXData := make([]float64, (XWindow.Rows)*XWindow.Cols)
-        newYData := make([]float64, (YWindow.Rows)*YWindow.Cols)
+func (s *ForecastServer) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+    d, err := s.Diagnostics()
+    if err != nil {
+        writeError(w, http.StatusNotFound, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, d)
+}
 
-        // Копируем все строки кроме первой (удаляем самую старую)
-        for j := 1; j < XWindow.Rows; j++ {
-            for c := 0; c < XWindow.Cols; c++ {
-                newXData[(j-1)*XWindow.Cols+c] = XWindow.At(j, c)
-            }
-        }
-        // Добавляем новую строку в конец
-        for c := 0; c < XWindow.Cols; c++ {
-            newXData[(XWindow.Rows-1)*XWindow.Cols+c] = newDayX.At(0, c)
+// safeCall выполняет f, превращая панику вычислительных функций
+// (например, вырожденную матрицу XᵀX) в ошибку
+func safeCall(f func()) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("ошибка расчета: %v", r)
         }
+    }()
+    f()
+    return nil
+}
 
-        // Аналогично для целевых значений
-        for j := 1; j < YWindow.Rows; j++ {
-            newYData[(j-1)*YWindow.Cols] = YWindow.At(j, 0)
+// matrixFromRows собирает матрицу из строк одинаковой длины
+func matrixFromRows(rows [][]float64) (Matrix, error) {
+    if len(rows) == 0 || len(rows[0]) == 0 {
+        return Matrix{}, errors.New("пустая матрица")
+    }
+    cols := len(rows[0])
+    data := make([]float64, 0, len(rows)*cols)
+    for i, row := range rows {
+        if len(row) != cols {
+            return Matrix{}, fmt.Errorf("строка %d содержит %d элементов вместо %d", i, len(row), cols)
         }
-        newYData[(YWindow.Rows-1)*YWindow.Cols] = actualYVal
-
-        XWindow = NewMatrix(XWindow.Rows, XWindow.Cols, newXData)
-        YWindow = NewMatrix(YWindow.Rows, YWindow.Cols, newYData)
+        data = append(data, row...)
     }
+    return NewMatrix(len(rows), cols, data), nil
+}
 
-    return PredictionResult{
-        Predictions:     predictions,
-        PredictionsLow:  predictionsLow,
-        PredictionsHigh: predictionsHigh,
-        Actuals:         actuals,
-        Days:            days,
+// writeJSON отправляет значение v в формате JSON с заданным кодом ответа
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        log.Printf("ошибка записи ответа: %v", err)
     }
 }
 
+// writeError отправляет ошибку в виде {"error": "..."}
+func writeError(w http.ResponseWriter, status int, err error) {
+    writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
 // Correlation вычисляет коэффициент корреляции Пирсона между двумя выборками
 // Возвращает значение от -1 до 1, где:
 //  1 - полная положительная корреляция
@@ -426,9 +3925,9 @@ func TInv(probability float64, df int) float64 {
         panic("Степени свободы должны быть положительными")
     }
 
-    // Для больших степеней свободы (>30) приближаем нормальным распределением
+    // Для больших степеней свободы (>30) квантиль находится обращением TCDF
     if df > 30 {
-        return NormalInv(probability)
+        return tQuantile(probability, df)
     }
 
     // Таблица критических значений t-распределения для различных df
@@ -449,6 +3948,11 @@ func TInv(probability float64, df int) float64 {
         30: {0.95: 1.697, 0.975: 2.042},
     }
 
+    // Таблица содержит только уровни 0.95 и 0.975, для остальных - точный квантиль
+    if _, exists := tTable[1][probability]; !exists {
+        return tQuantile(probability, df)
+    }
+
     // Поиск значения в таблице
     if dfTable, exists := tTable[df]; exists {
         if value, exists := dfTable[probability]; exists {
@@ -456,24 +3960,31 @@ func TInv(probability float64, df int) float64 {
         }
     }
 
-    // Линейная интерполяция для отсутствующих в таблице значений df
-    keys := make([]int, 0, len(tTable))
-    for k := range tTable {
-        keys = append(keys, k)
+    // Для отсутствующих в таблице значений df вычисляем точный квантиль
+    return tQuantile(probability, df)
+}
+
+// tQuantile вычисляет квантиль t-распределения уровня p методом Ньютона
+// по TCDF, начиная с квантиля нормального распределения
+func tQuantile(p float64, df int) float64 {
+    if p <= 0 || p >= 1 {
+        panic("Вероятность должна быть в интервале (0, 1)")
     }
-    sort.Ints(keys) // Сортируем ключи для интерполяции
+    v := float64(df)
+    lnNumerator, _ := math.Lgamma((v + 1) / 2)
+    lnDenominator, _ := math.Lgamma(v / 2)
+    lnNorm := lnNumerator - lnDenominator - 0.5*math.Log(v*math.Pi)
 
-    for i := 0; i < len(keys)-1; i++ {
-        if df >= keys[i] && df <= keys[i+1] {
-            lower := tTable[keys[i]][probability]
-            upper := tTable[keys[i+1]][probability]
-            weight := float64(df-keys[i]) / float64(keys[i+1]-keys[i])
-            return lower + weight*(upper-lower)
+    t := NormalInv(p)
+    for iteration := 0; iteration < 50; iteration++ {
+        density := math.Exp(lnNorm - (v+1)/2*math.Log1p(t*t/v))
+        step := (TCDF(t, df) - p) / density
+        t -= step
+        if math.Abs(step) < 1e-12*(1+math.Abs(t)) {
+            break
         }
     }
-
-    // Если df больше максимального в таблице, используем нормальное приближение
-    return NormalInv(probability)
+    return t
 }
 
 // FInv вычисляет критическое значение F-распределения Фишера
@@ -515,36 +4026,249 @@ func FInv(alpha float64, df1, df2 int) float64 {
         }
     }
 
-    // Упрощенное значение при отсутствии в таблице
-    return 3.0
+    // Отсутствующие в таблице значения вычисляются обращением FCDF
+    return fQuantile(1-alpha, df1, df2)
+}
+
+// fQuantile вычисляет квантиль F-распределения уровня p делением отрезка
+// пополам по FCDF: функция монотонна, а граница отрезка удваивается,
+// пока не накроет квантиль
+func fQuantile(p float64, df1, df2 int) float64 {
+    if p <= 0 || p >= 1 {
+        panic("Вероятность должна быть в интервале (0, 1)")
+    }
+    low, high := 0.0, 1.0
+    for FCDF(high, df1, df2) < p {
+        low, high = high, 2*high
+    }
+    for iteration := 0; iteration < 200 && high-low > 1e-14*high; iteration++ {
+        middle := (low + high) / 2
+        if FCDF(middle, df1, df2) < p {
+            low = middle
+        } else {
+            high = middle
+        }
+    }
+    return (low + high) / 2
 }
 
 // NormalInv вычисляет квантиль стандартного нормального распределения
-// Используется аппроксимация Пэка для обратной функции нормального распределения
+// Используется алгоритм AS241 (PPND16) Уичуры: рациональные приближения
+// в центре и хвостах с относительной погрешностью порядка 1e-16
 // p - вероятность (должна быть в интервале (0, 1))
 func NormalInv(p float64) float64 {
     if p <= 0 || p >= 1 {
         panic("Вероятность должна быть в интервале (0, 1)")
     }
 
-    // Для вероятностей меньше 0.5 используем симметричность распределения
-    if p < 0.5 {
-        return -NormalInv(1 - p)
+    // Центральная область |p - 0.5| <= 0.425
+    q := p - 0.5
+    if math.Abs(q) <= 0.425 {
+        r := 0.180625 - q*q
+        return q * (((((((2.5090809287301226727e+3*r+3.3430575583588128105e+4)*r+6.7265770927008700853e+4)*r+
+            4.5921953931549871457e+4)*r+1.3731693765509461125e+4)*r+1.9715909503065514427e+3)*r+
+            1.3314166789178437745e+2)*r + 3.3871328727963666080e+0) /
+            (((((((5.2264952788528545610e+3*r+2.8729085735721942674e+4)*r+3.9307895800092710610e+4)*r+
+                2.1213794301586595867e+4)*r+5.3941960214247511077e+3)*r+6.8718700749205790830e+2)*r+
+                4.2313330701600911252e+1)*r + 1)
+    }
+
+    // Хвосты: приближение по r = √(-ln(min(p, 1-p)))
+    r := p
+    if q > 0 {
+        r = 1 - p
+    }
+    r = math.Sqrt(-math.Log(r))
+    var value float64
+    if r <= 5 {
+        r -= 1.6
+        value = (((((((7.74545014278341407640e-4*r+2.27238449892691845833e-2)*r+2.41780725177450611770e-1)*r+
+            1.27045825245236838258e+0)*r+3.64784832476320460504e+0)*r+5.76949722146069140550e+0)*r+
+            4.63033784615654529590e+0)*r + 1.42343711074968357734e+0) /
+            (((((((1.05075007164441684324e-9*r+5.47593808499534494600e-4)*r+1.51986665636164571966e-2)*r+
+                1.48103976427480074590e-1)*r+6.89767334985100004550e-1)*r+1.67638483018380384940e+0)*r+
+                2.05319162663775882187e+0)*r + 1)
+    } else {
+        // Дальние хвосты (p < e⁻²⁵)
+        r -= 5
+        value = (((((((2.01033439929228813265e-7*r+2.71155556874348757815e-5)*r+1.24266094738807843860e-3)*r+
+            2.65321895265761230930e-2)*r+2.96560571828504891230e-1)*r+1.78482653991729133580e+0)*r+
+            5.46378491116411436990e+0)*r + 6.65790464350110377720e+0) /
+            (((((((2.04426310338993978564e-15*r+1.42151175831644588870e-7)*r+1.84631831751005468180e-5)*r+
+                7.86869131145613259100e-4)*r+1.48753612908506148525e-2)*r+1.36929880922735805310e-1)*r+
+                5.99832206555887937690e-1)*r + 1)
+    }
+    if q < 0 {
+        return -value
+    }
+    return value
+}
+
+// NormalCDF вычисляет функцию стандартного нормального распределения
+// Φ(x) = erfc(-x/√2)/2 без потери точности в хвостах
+func NormalCDF(x float64) float64 {
+    return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// TCDF вычисляет функцию t-распределения Стьюдента с df степенями свободы
+// через регуляризованную неполную бета-функцию: P(T > |t|) = I_x(df/2, 1/2)/2,
+// x = df/(df + t²)
+func TCDF(t float64, df int) float64 {
+    if df <= 0 {
+        panic("Степени свободы должны быть положительными")
+    }
+    v := float64(df)
+    tail := 0.5 * regularizedBeta(v/(v+t*t), v/2, 0.5)
+    if t > 0 {
+        return 1 - tail
+    }
+    return tail
+}
+
+// FCDF вычисляет функцию F-распределения Фишера со степенями свободы df1, df2:
+// P(F <= f) = I_x(df1/2, df2/2), x = df1·f/(df1·f + df2)
+func FCDF(f float64, df1, df2 int) float64 {
+    if df1 <= 0 || df2 <= 0 {
+        panic("Степени свободы должны быть положительными")
     }
+    if f <= 0 {
+        return 0
+    }
+    d1, d2 := float64(df1), float64(df2)
+    return regularizedBeta(d1*f/(d1*f+d2), d1/2, d2/2)
+}
 
-    // Аппроксимация Пэка для p >= 0.5
-    t := math.Sqrt(-2 * math.Log(1-p))
-    c0 := 2.515517
-    c1 := 0.802853
-    c2 := 0.010328
-    d1 := 1.432788
-    d2 := 0.189269
-    d3 := 0.001308
+// regularizedBeta вычисляет регуляризованную неполную бета-функцию I_x(a, b)
+// разложением в непрерывную дробь (метод Лентца)
+func regularizedBeta(x, a, b float64) float64 {
+    if x <= 0 {
+        return 0
+    }
+    if x >= 1 {
+        return 1
+    }
+    // Дробь быстро сходится при x < (a+1)/(a+b+2), иначе используется симметрия
+    if x > (a+1)/(a+b+2) {
+        return 1 - regularizedBeta(1-x, b, a)
+    }
+    lnBetaA, _ := math.Lgamma(a + b)
+    lnA, _ := math.Lgamma(a)
+    lnB, _ := math.Lgamma(b)
+    front := math.Exp(lnBetaA-lnA-lnB+a*math.Log(x)+b*math.Log(1-x)) / a
 
-    return t - (c0+c1*t+c2*t*t)/(1+d1*t+d2*t*t+d3*t*t*t)
+    const tiny = 1e-300
+    c, d := 1.0, 1-(a+b)*x/(a+1)
+    if math.Abs(d) < tiny {
+        d = tiny
+    }
+    d = 1 / d
+    f := d
+    for m := 1; m <= 300; m++ {
+        mf := float64(m)
+        // Четный член дроби
+        numerator := mf * (b - mf) * x / ((a + 2*mf - 1) * (a + 2*mf))
+        d = 1 + numerator*d
+        if math.Abs(d) < tiny {
+            d = tiny
+        }
+        c = 1 + numerator/c
+        if math.Abs(c) < tiny {
+            c = tiny
+        }
+        d = 1 / d
+        f *= d * c
+        // Нечетный член дроби
+        numerator = -(a + mf) * (a + b + mf) * x / ((a + 2*mf) * (a + 2*mf + 1))
+        d = 1 + numerator*d
+        if math.Abs(d) < tiny {
+            d = tiny
+        }
+        c = 1 + numerator/c
+        if math.Abs(c) < tiny {
+            c = tiny
+        }
+        d = 1 / d
+        delta := d * c
+        f *= delta
+        if math.Abs(delta-1) < 1e-15 {
+            break
+        }
+    }
+    return front * f
 }
 
 func main() {
+    // Адрес HTTP-сервиса прогнозирования; без флага выполняется пакетный расчет
+    serveAddr := flag.String("serve", "", "адрес HTTP-сервиса прогнозирования, например :8080")
+    // Центрирование и масштабирование признаков перед расширением
+    center := flag.Bool("center", false, "центрировать день и температуру перед расширением признаков")
+    scale := flag.Bool("scale", false, "делить день и температуру на СКО перед расширением признаков")
+    // Стандартизация матрицы плана с пересчетом коэффициентов в исходные единицы
+    standardize := flag.Bool("standardize", false, "стандартизовать столбцы матрицы плана перед расчетом коэффициентов")
+    // Календарные признаки: дата первого дня и файл праздников
+    startDate := flag.String("start-date", "", "дата дня 1 (ГГГГ-ММ-ДД) для признаков дней недели")
+    holidaysPath := flag.String("holidays", "", "файл праздничных дней (по одной дате ГГГГ-ММ-ДД в строке)")
+    // Оценка температуры баланса и излом температурной зависимости в ней
+    balancePoint := flag.Bool("balance-point", false, "оценить температуру баланса и добавить излом max(0, X3 - Tb)")
+    // Лаги потребления, например "1,7" для Y(t-1) и Y(t-7)
+    lagsY := flag.String("lags", "", "лаги потребления через запятую, например 1,7")
+    // ОМНК с AR(1)-ошибками: cochrane-orcutt или prais-winsten
+    estimator := flag.String("estimator", EstimatorOLS, "метод оценивания: ols, cochrane-orcutt, prais-winsten")
+    // Устойчивые стандартные ошибки коэффициентов и интервалов
+    covariance := flag.String("covariance", CovarianceClassical, "оценка ковариации: classical, hc0, hc1, hc2, hc3, newey-west")
+    nwLag := flag.Int("nw-lag", 0, "число лагов оценки Ньюи-Уэста (0 - автоматически)")
+    // Бутстреп-интервалы прогноза
+    interval := flag.String("interval", IntervalT, "метод интервалов: t, residual-bootstrap, pairs-bootstrap")
+    resamples := flag.Int("resamples", 999, "число бутстреп-выборок")
+    seed := flag.Int64("seed", 1, "начальное значение генератора бутстрепа")
+    // Квантильная регрессия, например "0.1,0.5,0.9"
+    quantilesFlag := flag.String("quantiles", "", "уровни квантилей через запятую для квантильной регрессии, например 0.1,0.5,0.9")
+    // Оценка калибровки интервалов скользящего прогноза
+    calibration := flag.Bool("calibration", false, "оценить покрытие, ширину, оценку Винклера, CRPS и PIT интервалов прогноза")
+    // Структурные сдвиги и дрейф коэффициентов
+    stability := flag.Bool("stability", false, "проверить устойчивость модели: тесты Чоу, CUSUM, CUSUMSQ и дрейф коэффициентов")
+    driftThreshold := flag.Float64("drift-threshold", 3, "порог дрейфа коэффициентов в стандартных ошибках")
+    // Адаптивное окно: детектор смены режима и границы длины окна
+    adaptiveDetector := flag.String("adaptive", "", "адаптивное окно с детектором смены режима: page-hinkley, cusum")
+    minWindow := flag.Int("min-window", 10, "длина адаптивного окна после смены режима")
+    maxWindow := flag.Int("max-window", 20, "максимальная длина адаптивного окна")
+    changeThreshold := flag.Float64("change-threshold", 5, "порог детектора смены режима в единицах σ")
+    // Ансамбль окон разной длины, например "10,15,20"
+    ensembleWindows := flag.String("ensemble", "", "размеры окон участников ансамбля через запятую, например 10,15,20")
+    combine := flag.String("combine", CombineInverseError, "объединение ансамбля: equal, inverse-error, stacking")
+    // Сравнение с базовыми методами прогноза
+    baselines := flag.Bool("baselines", false, "сравнить скользящую матрицу с базовыми прогнозами (наивный, сезонный, среднее, SES, Холт-Уинтерс)")
+    // Функция потерь теста Диболда-Мариано при сравнении с базовыми методами
+    dmLoss := flag.String("dm-loss", LossSquared, "функция потерь теста Диболда-Мариано: squared, absolute")
+    // Выгрузка истории моделей скользящего окна
+    historyPath := flag.String("history", "", "файл истории моделей скользящего окна (.csv или .json)")
+    flag.Parse()
+
+    opts := DefaultRegressionOptions()
+    opts.Design.Center = *center
+    opts.Design.Scale = *scale
+    opts.Standardize = *standardize
+    opts.Estimator = *estimator
+    opts.Covariance = *covariance
+    opts.NeweyWestLag = *nwLag
+    opts.Interval = *interval
+    opts.Resamples = *resamples
+    opts.Seed = *seed
+    if *startDate != "" {
+        calendar := &CalendarFeatures{StartDate: *startDate, DayOfWeek: true}
+        if _, err := time.Parse(calendarDateLayout, *startDate); err != nil {
+            log.Fatalf("Неверная дата -start-date: %v", err)
+        }
+        if *holidaysPath != "" {
+            holidays, err := LoadHolidays(*holidaysPath)
+            if err != nil {
+                log.Fatal(err)
+            }
+            calendar.Holidays = holidays
+        }
+        opts.Design.Calendar = calendar
+    }
+
     // Исходные данные для обучения модели (первые 20 дней)
     // Матрица X: каждая строка содержит [номер дня, температура]
     rawXInitial := NewMatrix(20, 2, []float64{
@@ -597,19 +4321,93 @@ func main() {
         3996.3,
     })
 
+    if *lagsY != "" {
+        lags := &LagFeatures{}
+        for _, field := range strings.Split(*lagsY, ",") {
+            lag, err := strconv.Atoi(strings.TrimSpace(field))
+            if err != nil || lag <= 0 {
+                log.Fatalf("Неверный лаг %q в -lags", field)
+            }
+            lags.Y = append(lags.Y, lag)
+        }
+        opts.Design.Lags = lags
+    }
+    var taus []float64
+    if *quantilesFlag != "" {
+        for _, field := range strings.Split(*quantilesFlag, ",") {
+            tau, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+            if err != nil || tau <= 0 || tau >= 1 {
+                log.Fatalf("Неверный уровень квантиля %q в -quantiles", field)
+            }
+            taus = append(taus, tau)
+        }
+    }
+    if *balancePoint {
+        balance := EstimateBalancePoint(rawXInitial, YInitial, opts, nil)
+        fmt.Printf("Температура баланса: %.1f °C (остаточная дисперсия %.1f)\n", balance.Temperature, balance.Result.Dad)
+        opts.Design = balance.Result.Design
+        opts.Design.Means, opts.Design.Scales = nil, nil
+    }
+
+    // Режим HTTP-сервиса: модель обучается на исходных 20 днях с настройками
+    // из флагов, далее окно сдвигается запросами /observe
+    if *serveAddr != "" {
+        server := NewForecastServer(opts)
+        if err := server.Fit(rawXInitial, YInitial); err != nil {
+            log.Fatal(err)
+        }
+        log.Printf("Сервис прогнозирования запущен на %s", *serveAddr)
+        log.Fatal(http.ListenAndServe(*serveAddr, server.Handler()))
+    }
+
     // Объединение данных для отображения полной картины в результатах
     allYData := append(YInitial.Data, additionalY.Data...)
     allY := NewMatrix(26, 1, allYData)
 
     // Регрессионный анализ на исходных данных (20 дней)
     fmt.Println("Регрессия на исходных данных (20 дней):")
-    resultInitial := RunRegression(rawXInitial, YInitial)
+    resultInitial := RunRegressionWithOptions(rawXInitial, YInitial, opts)
+    fmt.Printf("Модель %s. Коэффициент корреляции: %.4f\n", resultInitial.Decision, resultInitial.Correlation)
+    for _, warning := range resultInitial.Warnings {
+        fmt.Println("Предупреждение:", warning)
+    }
+    if resultInitial.Estimator != EstimatorOLS {
+        fmt.Printf("Автокорреляция ошибок ρ = %.4f (итераций: %d)\n", resultInitial.Rho, resultInitial.Iterations)
+    }
 
     // Прогнозирование с обновлением модели по скользящему окну
     fmt.Println("\nПрогнозирование с использованием скользящего окна:")
-    predictionResults := RollingWindowPrediction(
-        rawXInitial, YInitial, additionalX, additionalY, 20,
-    )
+    var predictionResults PredictionResult
+    if *adaptiveDetector != "" {
+        adaptive := AdaptiveWindow{
+            MinSize:  *minWindow,
+            MaxSize:  *maxWindow,
+            Detector: ChangeDetector{Method: *adaptiveDetector, Threshold: *changeThreshold},
+        }
+        predictionResults, _ = AdaptiveWindowPrediction(context.Background(),
+            rawXInitial, YInitial, additionalX, additionalY, adaptive, opts,
+        )
+    } else {
+        predictionResults, _ = RollingWindowPredictionContext(context.Background(),
+            rawXInitial, YInitial, additionalX, additionalY, 20, opts,
+        )
+    }
+    for i := 0; i < len(predictionResults.Days); i++ {
+        step := predictionResults.History[i]
+        fmt.Printf("Модель %s. Коэффициент корреляции: %.4f\n", step.Decision, step.Correlation)
+        fmt.Printf("День %d: Температура = %.2f, Фактическое Y = %.2f, Прогнозное Y = %.2f\n",
+            predictionResults.Days[i], additionalX.At(i, 1),
+            predictionResults.Actuals[i], predictionResults.Predictions[i])
+    }
+    if *adaptiveDetector != "" {
+        fmt.Println("Длина окна по дням:", predictionResults.WindowSizes)
+        fmt.Println("Смена режима после дней:", predictionResults.ChangePoints)
+    }
+    if *historyPath != "" {
+        if err := SaveHistory(*historyPath, predictionResults); err != nil {
+            log.Fatal(err)
+        }
+    }
 
     // Вывод коэффициентов регрессионной модели
     fmt.Println("\nКоэффициенты регрессионной модели для исходных данных:")
@@ -632,11 +4430,17 @@ func main() {
     fmt.Println("День | Факт Y | Расчет YR | Прогноз | Дов.интер.Min | Дов.интер.Max ")
     fmt.Println("-----|--------|-----------|---------|--------|--------")
 
-    // Результаты для дней 1-20 (обучающая выборка)
+    // Результаты для дней 1-20 (обучающая выборка); при лагах первые дни
+    // служат только предысторией и расчетных значений не имеют
+    offset := 20 - len(resultInitial.YR)
     for i := 0; i < 20; i++ {
+        if i < offset {
+            fmt.Printf("%4d | %6.1f | %9s | %7s | %6s | %6s\n", i+1, allY.At(i, 0), "-", "-", "-", "-")
+            continue
+        }
         fmt.Printf("%4d | %6.1f | %9.1f | %7s | %6.1f | %6.1f\n",
-            i+1, allY.At(i, 0), resultInitial.YR[i], "-",
-            resultInitial.YConfLow[i], resultInitial.YConfHigh[i])
+            i+1, allY.At(i, 0), resultInitial.YR[i-offset], "-",
+            resultInitial.YConfLow[i-offset], resultInitial.YConfHigh[i-offset])
     }
     // Результаты для дней 21-26 (прогноз с обновлением модели)
     for i := 0; i < len(predictionResults.Days); i++ {
@@ -646,4 +4450,103 @@ func main() {
             predictionResults.PredictionsLow[i],
             predictionResults.PredictionsHigh[i])
     }
+    // Калибровка интервалов прогнозов дней 21-26
+    if *calibration {
+        evaluation := EvaluateIntervals(predictionResults, 5)
+        fmt.Println("\nКалибровка интервалов прогноза:")
+        fmt.Printf("Покрытие: %.1f%% (номинальное %.1f%%)\n", 100*evaluation.Coverage, 100*evaluation.NominalCoverage)
+        fmt.Printf("Средняя ширина интервала: %.1f\n", evaluation.MeanWidth)
+        fmt.Printf("Оценка Винклера: %.1f\n", evaluation.WinklerScore)
+        fmt.Printf("CRPS: %.1f\n", evaluation.CRPS)
+        fmt.Println("Гистограмма PIT:", evaluation.PITHistogram)
+    }
+
+    // Устойчивость модели на исходных данных и дрейф коэффициентов окна
+    if *stability {
+        fmt.Println("\nУстойчивость модели:")
+        for _, chow := range ChowTests(rawXInitial, YInitial, nil, opts) {
+            fmt.Printf("Тест Чоу, сдвиг с дня %d: F = %.3f, Fкрит = %.3f, p = %.4f, сдвиг: %t\n",
+                chow.Break+1, chow.F, chow.FCritical, chow.PValue, chow.Shift)
+        }
+        recursive := RecursiveStability(rawXInitial, YInitial, opts)
+        fmt.Printf("CUSUM: выход за границы %t, CUSUMSQ: выход за границы %t\n", recursive.CUSUMBreak, recursive.CUSUMSQBreak)
+        for _, alert := range CoefficientDrift(predictionResults, *driftThreshold) {
+            fmt.Printf("Дрейф коэффициента %s в день %d: %.4f -> %.4f (%.1f SE)\n",
+                alert.Term, alert.Day, alert.From, alert.To, alert.Change)
+        }
+    }
+
+    // Сравнение точности со стандартными базовыми методами
+    if *baselines {
+        fmt.Println("\nСравнение с базовыми прогнозами:")
+        fmt.Println("Метод                | MAE    | RMSE   | MAPE,% | Смещение")
+        fmt.Println("---------------------|--------|--------|--------|---------")
+        printMetrics := func(name string, result PredictionResult) {
+            metrics := EvaluateForecasts(result)
+            fmt.Printf("%-20s | %6.1f | %6.1f | %6.2f | %8.1f\n", name, metrics.MAE, metrics.RMSE, metrics.MAPE, metrics.Bias)
+        }
+        printMetrics("Скользящая матрица", predictionResults)
+        for _, method := range []string{BaselineNaive, BaselineSeasonalNaive, BaselineMovingAverage, BaselineSES, BaselineHoltWinters} {
+            result, err := RollingBaselinePrediction(context.Background(), YInitial, additionalY, 20, Baseline{Method: method})
+            if err != nil {
+                log.Fatal(err)
+            }
+            printMetrics(method, result)
+            var dm DieboldMarianoResult
+            if err := safeCall(func() { dm = DieboldMariano(predictionResults, result, *dmLoss, 1) }); err != nil {
+                fmt.Printf("%-20s   тест Диболда-Мариано: %v\n", "", err)
+                continue
+            }
+            fmt.Printf("%-20s   тест Диболда-Мариано: DM = %.3f, HLN = %.3f, p = %.4f\n", "", dm.Statistic, dm.HLN, dm.PValue)
+        }
+    }
+
+    // Ансамбль скользящих окон разной длины
+    if *ensembleWindows != "" {
+        var members []EnsembleMember
+        for _, field := range strings.Split(*ensembleWindows, ",") {
+            size, err := strconv.Atoi(strings.TrimSpace(field))
+            if err != nil || size <= 0 {
+                log.Fatalf("Неверный размер окна %q в -ensemble", field)
+            }
+            members = append(members, EnsembleMember{Name: fmt.Sprintf("окно %d", size), WindowSize: size, Options: opts})
+        }
+        ensemble, err := EnsemblePrediction(context.Background(), rawXInitial, YInitial, additionalX, additionalY, members, *combine)
+        if err != nil {
+            log.Fatal(err)
+        }
+        fmt.Printf("\nАнсамбль (%s):\n", *combine)
+        for t, day := range ensemble.Combined.Days {
+            fmt.Printf("День %d: Прогноз = %.2f [%.2f; %.2f], Факт = %.2f, вклады:",
+                day, ensemble.Combined.Predictions[t], ensemble.Combined.PredictionsLow[t],
+                ensemble.Combined.PredictionsHigh[t], ensemble.Combined.Actuals[t])
+            for m, name := range ensemble.Members {
+                fmt.Printf(" %s = %.1f (вес %.2f)", name, ensemble.Contributions[t][m], ensemble.Weights[t][m])
+            }
+            fmt.Println()
+        }
+    }
+
+    // Прогнозы квантилей со скользящим окном
+    if len(taus) > 0 {
+        quantileResults, _ := RollingQuantilePrediction(context.Background(),
+            rawXInitial, YInitial, additionalX, additionalY, 20, taus, opts,
+        )
+        fmt.Println("\nКвантильная регрессия со скользящим окном:")
+        fmt.Print("День | Факт Y")
+        for _, tau := range quantileResults.Taus {
+            fmt.Printf(" | Q%-5g", tau)
+        }
+        fmt.Println()
+        for i, day := range quantileResults.Days {
+            fmt.Printf("%4d | %6.1f", day, quantileResults.Actuals[i])
+            for _, q := range quantileResults.Quantiles[i] {
+                fmt.Printf(" | %6.1f", q)
+            }
+            fmt.Println()
+        }
+        for j, tau := range quantileResults.Taus {
+            fmt.Printf("Pinball-потеря квантиля %g: %.2f\n", tau, quantileResults.Pinball[j])
+        }
+    }
 }
@@ -0,0 +1,1451 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// sampleData возвращает исходную выборку программы: 20 дней [номер дня, температура]
+// и потребление электроэнергии за каждый день
+func sampleData() (Matrix, Matrix) {
+    X := NewMatrix(20, 2, []float64{
+        1, 21.5, 2, 21.2, 3, 22.1, 4, 25.1, 5, 26.4,
+        6, 22.6, 7, 17.7, 8, 18.5, 9, 21.2, 10, 20.3,
+        11, 17, 12, 19.2, 13, 19.4, 14, 21.9, 15, 25.5,
+        16, 26.3, 17, 26.3, 18, 24.7, 19, 21.4, 20, 21.04,
+    })
+    Y := NewMatrix(20, 1, []float64{
+        2357.85, 2669.7, 2669.7, 2998.05, 3512.85, 3542.55, 3248.85, 3341.25,
+        3453.45, 3598.65, 3413.85, 4271.85, 4393.95, 3686.1, 3682.8, 3550.8,
+        4719, 3979.35, 4131.6, 4141.5,
+    })
+    return X, Y
+}
+
+// matrixRows преобразует матрицу в строки для JSON-запросов
+func matrixRows(m Matrix) [][]float64 {
+    rows := make([][]float64, m.Rows)
+    for i := range rows {
+        rows[i] = append([]float64(nil), m.Row(i)...)
+    }
+    return rows
+}
+
+// doJSON выполняет запрос к обработчику и декодирует JSON-ответ в out (если out != nil)
+func doJSON(t *testing.T, h http.Handler, method, path string, body any, out any) int {
+    t.Helper()
+    var reader *bytes.Reader
+    switch b := body.(type) {
+    case nil:
+        reader = bytes.NewReader(nil)
+    case string:
+        reader = bytes.NewReader([]byte(b))
+    default:
+        data, err := json.Marshal(b)
+        if err != nil {
+            t.Fatal(err)
+        }
+        reader = bytes.NewReader(data)
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+    if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+        t.Errorf("%s %s: Content-Type = %q", method, path, ct)
+    }
+    if out != nil && rec.Code == http.StatusOK {
+        if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+            t.Fatalf("%s %s: ответ не JSON: %v", method, path, err)
+        }
+    }
+    return rec.Code
+}
+
+// fittedServer возвращает обработчик сервиса, обученного на исходной выборке
+func fittedServer(t *testing.T) http.Handler {
+    t.Helper()
+    X, Y := sampleData()
+    h := NewForecastServer(DefaultRegressionOptions()).Handler()
+    if code := doJSON(t, h, "POST", "/fit", fitRequest{X: matrixRows(X), Y: Y.Data}, nil); code != http.StatusOK {
+        t.Fatalf("POST /fit: статус %d", code)
+    }
+    return h
+}
+
+func TestServerFitAndPredict(t *testing.T) {
+    X, Y := sampleData()
+    h := NewForecastServer(DefaultRegressionOptions()).Handler()
+
+    var d Diagnostics
+    if code := doJSON(t, h, "POST", "/fit", fitRequest{X: matrixRows(X), Y: Y.Data}, &d); code != http.StatusOK {
+        t.Fatalf("POST /fit: статус %d", code)
+    }
+    if d.WindowSize != 20 || len(d.B) != 5 || d.Decision == "" || d.Correlation == nil {
+        t.Fatalf("POST /fit: неполная диагностика %+v", d)
+    }
+
+    // Прогноз сервиса совпадает с прогнозом модели, обученной напрямую
+    var resp struct{ Forecasts []Forecast }
+    if code := doJSON(t, h, "POST", "/predict", predictRequest{X: [][]float64{{21, 21.3}, {22, 23}}}, &resp); code != http.StatusOK {
+        t.Fatalf("POST /predict: статус %d", code)
+    }
+    want := NewModel(RunRegression(X, Y)).Predict(NewMatrix(2, 2, []float64{21, 21.3, 22, 23}))
+    if len(resp.Forecasts) != 2 {
+        t.Fatalf("POST /predict: %d прогнозов вместо 2", len(resp.Forecasts))
+    }
+    for i, f := range resp.Forecasts {
+        if f != want[i] {
+            t.Errorf("прогноз %d = %+v, ожидается %+v", i, f, want[i])
+        }
+        if !(f.Low < f.Y && f.Y < f.High) {
+            t.Errorf("прогноз %d вне интервала: %+v", i, f)
+        }
+    }
+
+    var got Diagnostics
+    if code := doJSON(t, h, "GET", "/diagnostics", nil, &got); code != http.StatusOK {
+        t.Fatalf("GET /diagnostics: статус %d", code)
+    }
+    if got.Dad != d.Dad {
+        t.Errorf("GET /diagnostics: Dad = %v, ожидается %v", got.Dad, d.Dad)
+    }
+}
+
+func TestServerUsesOptions(t *testing.T) {
+    X, Y := sampleData()
+    opts := DefaultRegressionOptions()
+    opts.Design.Lags = &LagFeatures{Y: []int{1}}
+    opts.Estimator = EstimatorPraisWinsten
+    h := NewForecastServer(opts).Handler()
+
+    var d Diagnostics
+    if code := doJSON(t, h, "POST", "/fit", fitRequest{X: matrixRows(X), Y: Y.Data}, &d); code != http.StatusOK {
+        t.Fatalf("POST /fit: статус %d", code)
+    }
+    want := RunRegressionWithOptions(X, Y, opts)
+    if len(d.Terms) != 6 || d.Terms[5] != "Y(t-1)" || d.Dad != want.Dad {
+        t.Fatalf("модель сервиса обучена без настроек: %+v", d)
+    }
+
+    // Модель с лагом ожидает в строке X значение Y(t-1)
+    var resp struct{ Forecasts []Forecast }
+    if code := doJSON(t, h, "POST", "/predict", predictRequest{X: [][]float64{{21, 21.3, 4141.5}}}, &resp); code != http.StatusOK {
+        t.Fatalf("POST /predict: статус %d", code)
+    }
+    if code := doJSON(t, h, "POST", "/predict", predictRequest{X: [][]float64{{21, 21.3}}}, nil); code != http.StatusBadRequest {
+        t.Errorf("POST /predict без лага: статус %d", code)
+    }
+}
+
+func TestServerObserveSlidesWindow(t *testing.T) {
+    X, Y := sampleData()
+    h := fittedServer(t)
+
+    var d Diagnostics
+    if code := doJSON(t, h, "POST", "/observe", observeRequest{X: []float64{21, 21.3}, Y: 4027.65}, &d); code != http.StatusOK {
+        t.Fatalf("POST /observe: статус %d", code)
+    }
+    if d.WindowSize != 20 {
+        t.Errorf("размер окна после /observe = %d, ожидается 20", d.WindowSize)
+    }
+
+    // Окно сдвинулось: модель совпадает с регрессией на днях 2-21
+    shiftedX := NewMatrix(20, 2, append(append([]float64{}, X.Data[2:]...), 21, 21.3))
+    shiftedY := NewMatrix(20, 1, append(append([]float64{}, Y.Data[1:]...), 4027.65))
+    want := RunRegression(shiftedX, shiftedY)
+
+    var m Model
+    if code := doJSON(t, h, "GET", "/model", nil, &m); code != http.StatusOK {
+        t.Fatalf("GET /model: статус %d", code)
+    }
+    for i, b := range m.B {
+        if b != want.B.Data[i] {
+            t.Errorf("B%d = %v после сдвига окна, ожидается %v", i, b, want.B.Data[i])
+        }
+    }
+    if m.Dad != want.Dad {
+        t.Errorf("Dad = %v после сдвига окна, ожидается %v", m.Dad, want.Dad)
+    }
+}
+
+func TestServerModelRoundTrip(t *testing.T) {
+    h := fittedServer(t)
+    var m Model
+    if code := doJSON(t, h, "GET", "/model", nil, &m); code != http.StatusOK {
+        t.Fatalf("GET /model: статус %d", code)
+    }
+
+    // Загруженная модель дает те же прогнозы, но не имеет окна данных
+    loaded := NewForecastServer(DefaultRegressionOptions()).Handler()
+    var d Diagnostics
+    if code := doJSON(t, loaded, "PUT", "/model", m, &d); code != http.StatusOK {
+        t.Fatalf("PUT /model: статус %d", code)
+    }
+    if d.WindowSize != 0 || d.Correlation != nil {
+        t.Errorf("у загруженной модели не должно быть окна: %+v", d)
+    }
+    request := predictRequest{X: [][]float64{{21, 21.3}}}
+    var want, got struct{ Forecasts []Forecast }
+    doJSON(t, h, "POST", "/predict", request, &want)
+    if code := doJSON(t, loaded, "POST", "/predict", request, &got); code != http.StatusOK {
+        t.Fatalf("POST /predict: статус %d", code)
+    }
+    if got.Forecasts[0] != want.Forecasts[0] {
+        t.Errorf("прогноз загруженной модели %+v, ожидается %+v", got.Forecasts[0], want.Forecasts[0])
+    }
+    if code := doJSON(t, loaded, "POST", "/observe", observeRequest{X: []float64{21, 21.3}, Y: 4027.65}, nil); code != http.StatusUnprocessableEntity {
+        t.Errorf("POST /observe без окна: статус %d, ожидается 422", code)
+    }
+}
+
+func TestServerWithoutModel(t *testing.T) {
+    h := NewForecastServer(DefaultRegressionOptions()).Handler()
+    requests := []struct {
+        method, path string
+        body         any
+    }{
+        {"GET", "/model", nil},
+        {"GET", "/diagnostics", nil},
+        {"POST", "/predict", predictRequest{X: [][]float64{{21, 21.3}}}},
+        {"POST", "/observe", observeRequest{X: []float64{21, 21.3}, Y: 4027.65}},
+    }
+    for _, r := range requests {
+        if code := doJSON(t, h, r.method, r.path, r.body, nil); code != http.StatusNotFound {
+            t.Errorf("%s %s без модели: статус %d, ожидается 404", r.method, r.path, code)
+        }
+    }
+}
+
+func TestServerBadRequests(t *testing.T) {
+    X, Y := sampleData()
+    h := fittedServer(t)
+    requests := []struct {
+        name, method, path string
+        body               any
+        status             int
+    }{
+        {"fit: не JSON", "POST", "/fit", "{", http.StatusBadRequest},
+        {"fit: пустая X", "POST", "/fit", fitRequest{}, http.StatusBadRequest},
+        {"fit: строки разной длины", "POST", "/fit", fitRequest{X: [][]float64{{1, 2}, {3}}, Y: []float64{1, 2}}, http.StatusBadRequest},
+        {"fit: длина Y", "POST", "/fit", fitRequest{X: matrixRows(X), Y: Y.Data[:19]}, http.StatusBadRequest},
+        {"fit: мало наблюдений", "POST", "/fit", fitRequest{X: matrixRows(X.RowsView(0, 4)), Y: Y.Data[:4]}, http.StatusUnprocessableEntity},
+        {"predict: не JSON", "POST", "/predict", "[", http.StatusBadRequest},
+        {"predict: число признаков", "POST", "/predict", predictRequest{X: [][]float64{{21}}}, http.StatusBadRequest},
+        {"observe: не JSON", "POST", "/observe", "x", http.StatusBadRequest},
+        {"observe: число признаков", "POST", "/observe", observeRequest{X: []float64{21}, Y: 1}, http.StatusUnprocessableEntity},
+        {"put: не JSON", "PUT", "/model", "{", http.StatusBadRequest},
+        {"put: версия", "PUT", "/model", Model{Version: 99}, http.StatusUnprocessableEntity},
+        {"метод", "DELETE", "/model", nil, http.StatusMethodNotAllowed},
+    }
+    for _, r := range requests {
+        rec := httptest.NewRecorder()
+        var body []byte
+        switch b := r.body.(type) {
+        case nil:
+        case string:
+            body = []byte(b)
+        default:
+            body, _ = json.Marshal(b)
+        }
+        h.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, bytes.NewReader(body)))
+        if rec.Code != r.status {
+            t.Errorf("%s: статус %d, ожидается %d (%s)", r.name, rec.Code, r.status, rec.Body.String())
+        }
+    }
+
+    // Ошибочный запрос не меняет окно
+    var d Diagnostics
+    doJSON(t, h, "GET", "/diagnostics", nil, &d)
+    if d.WindowSize != 20 {
+        t.Errorf("размер окна после ошибочных запросов = %d, ожидается 20", d.WindowSize)
+    }
+}
+
+func TestServerRejectsInconsistentModel(t *testing.T) {
+    h := fittedServer(t)
+    var m Model
+    doJSON(t, h, "GET", "/model", nil, &m)
+
+    // Календарные признаки без соответствующих коэффициентов
+    calendar := m
+    calendar.Design.Calendar = &CalendarFeatures{StartDate: "2024-01-01", DayOfWeek: true}
+    // Неизвестная схема расширения
+    unknown := m
+    unknown.Design.Name = "poly3"
+    // Неверная начальная дата календаря
+    badDate := m
+    badDate.Design.Calendar = &CalendarFeatures{StartDate: "01.01.2024"}
+    // Лишний коэффициент
+    extra := m
+    extra.B = append(append([]float64{}, m.B...), 1)
+
+    for name, bad := range map[string]Model{"календарь": calendar, "схема": unknown, "дата": badDate, "коэффициенты": extra} {
+        loaded := NewForecastServer(DefaultRegressionOptions()).Handler()
+        if code := doJSON(t, loaded, "PUT", "/model", bad, nil); code != http.StatusUnprocessableEntity {
+            t.Errorf("PUT /model (%s): статус %d, ожидается 422", name, code)
+        }
+        if code := doJSON(t, loaded, "POST", "/predict", predictRequest{X: [][]float64{{21, 21.3}}}, nil); code != http.StatusNotFound {
+            t.Errorf("POST /predict после отклоненной модели (%s): статус %d, ожидается 404", name, code)
+        }
+    }
+}
+
+func TestPredictFromFile(t *testing.T) {
+    X, Y := sampleData()
+    model := NewModel(RunRegression(X, Y))
+    path := t.TempDir() + "/model.json"
+    if err := SaveModel(path, model); err != nil {
+        t.Fatal(err)
+    }
+
+    newX := NewMatrix(1, 2, []float64{21, 21.3})
+    forecasts, err := Predict(path, newX)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := model.Predict(newX); forecasts[0] != want[0] {
+        t.Errorf("прогноз по файлу %+v, ожидается %+v", forecasts[0], want[0])
+    }
+
+    // Неверное число признаков - ошибка, а не паника
+    if _, err := Predict(path, NewMatrix(1, 3, []float64{21, 21.3, 0})); err == nil {
+        t.Error("Predict с тремя признаками должен вернуть ошибку")
+    }
+    if _, err := Predict(t.TempDir()+"/missing.json", newX); err == nil {
+        t.Error("Predict без файла модели должен вернуть ошибку")
+    }
+}
+
+// randomMatrix возвращает матрицу rows×cols с псевдослучайными элементами
+func randomMatrix(rng *rand.Rand, rows, cols int) Matrix {
+    data := make([]float64, rows*cols)
+    for i := range data {
+        data[i] = rng.NormFloat64()
+    }
+    return NewMatrix(rows, cols, data)
+}
+
+// Размеры для сравнения ядер умножения: матрица плана 5×5, часовые данные
+// (тысячи строк, десятки признаков) и нормальные уравнения XᵀX
+type multiplyShape struct {
+    name    string
+    m, n, p int
+}
+
+var multiplyShapes = []multiplyShape{
+    {"5x5", 5, 5, 5},
+    {"5000x40x40", 5000, 40, 40},
+    {"XtX_40x5000x40", 40, 5000, 40},
+}
+
+func TestMultiplyMatchesNaive(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    // Размеры, не кратные блоку, проверяют обработку неполных блоков
+    shapes := append([]multiplyShape{{"130x67x129", 130, 67, 129}}, multiplyShapes...)
+    for _, shape := range shapes {
+        a := randomMatrix(rng, shape.m, shape.n)
+        b := randomMatrix(rng, shape.n, shape.p)
+        want := multiplyNaive(a, b)
+        // Порядок суммирования одинаков, поэтому результаты совпадают точно
+        for _, workers := range []int{1, 4} {
+            if got := multiplyWorkers(a, b, workers); !got.Equal(want, 0) {
+                t.Errorf("%s: блочное умножение (%d горутин) расходится с эталоном", shape.name, workers)
+            }
+        }
+    }
+}
+
+func BenchmarkMultiply(b *testing.B) {
+    rng := rand.New(rand.NewSource(1))
+    kernels := []struct {
+        name     string
+        multiply func(a, b Matrix) Matrix
+    }{
+        {"naive", multiplyNaive},
+        {"blocked", func(a, b Matrix) Matrix { return multiplyWorkers(a, b, 1) }},
+        {"parallel", Multiply},
+    }
+    for _, shape := range multiplyShapes {
+        x := randomMatrix(rng, shape.m, shape.n)
+        y := randomMatrix(rng, shape.n, shape.p)
+        for _, kernel := range kernels {
+            b.Run(shape.name+"/"+kernel.name, func(b *testing.B) {
+                for b.Loop() {
+                    kernel.multiply(x, y)
+                }
+            })
+        }
+    }
+}
+
+// fromRows собирает матрицу из строк
+func fromRows(rows ...[]float64) Matrix {
+    var data []float64
+    for _, row := range rows {
+        data = append(data, row...)
+    }
+    return NewMatrix(len(rows), len(rows[0]), data)
+}
+
+// reconstruct возвращает U·diag(s)·Vᵀ
+func reconstruct(U Matrix, s []float64, V Matrix) Matrix {
+    US := U.Clone()
+    for i := 0; i < US.Rows; i++ {
+        for j := range s {
+            US.Set(i, j, US.At(i, j)*s[j])
+        }
+    }
+    return Multiply(US, Transpose(V))
+}
+
+func TestLU(t *testing.T) {
+    // 2x + y + z = 5, 4x - 6y = -2, -2x + 7y + 2z = 9: решение (1, 1, 2), det = -16
+    A := fromRows([]float64{2, 1, 1}, []float64{4, -6, 0}, []float64{-2, 7, 2})
+    lu := NewLU(A)
+    x := lu.Solve(fromRows([]float64{5}, []float64{-2}, []float64{9}))
+    if !x.Equal(fromRows([]float64{1}, []float64{1}, []float64{2}), 1e-12) {
+        t.Errorf("Solve = %v, ожидалось [1 1 2]", x.Data)
+    }
+    if det := lu.Det(); !closeTo(det, -16, 1e-12) {
+        t.Errorf("Det = %v, ожидалось -16", det)
+    }
+    if logDet := lu.LogDet(); !closeTo(logDet, math.Log(16), 1e-12) {
+        t.Errorf("LogDet = %v, ожидалось ln 16", logDet)
+    }
+    if !Multiply(A, lu.Inverse()).Equal(Identity(3), 1e-12) {
+        t.Error("A·A⁻¹ != I")
+    }
+    if !Inverse(A).Equal(lu.Inverse(), 0) {
+        t.Error("Inverse расходится с LU.Inverse")
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Error("NewLU для вырожденной матрицы должен паниковать")
+        }
+    }()
+    NewLU(fromRows([]float64{1, 2}, []float64{2, 4}))
+}
+
+func TestCholesky(t *testing.T) {
+    // A = L·Lᵀ при L = [[2 0 0] [6 1 0] [-8 5 3]], det = (2·1·3)² = 36
+    A := fromRows([]float64{4, 12, -16}, []float64{12, 37, -43}, []float64{-16, -43, 98})
+    chol := NewCholesky(A)
+    L := fromRows([]float64{2, 0, 0}, []float64{6, 1, 0}, []float64{-8, 5, 3})
+    if !chol.L.Equal(L, 1e-12) {
+        t.Errorf("L = %v, ожидалось %v", chol.L.Data, L.Data)
+    }
+    // Правая часть A·(1, 2, 3)ᵀ
+    x := chol.Solve(fromRows([]float64{-20}, []float64{-43}, []float64{192}))
+    if !x.Equal(fromRows([]float64{1}, []float64{2}, []float64{3}), 1e-12) {
+        t.Errorf("Solve = %v, ожидалось [1 2 3]", x.Data)
+    }
+    if det := chol.Det(); !closeTo(det, 36, 1e-12) {
+        t.Errorf("Det = %v, ожидалось 36", det)
+    }
+    if logDet := chol.LogDet(); !closeTo(logDet, math.Log(36), 1e-12) {
+        t.Errorf("LogDet = %v, ожидалось ln 36", logDet)
+    }
+    if !chol.Inverse().Equal(NewLU(A).Inverse(), 1e-12) {
+        t.Error("Cholesky.Inverse расходится с LU.Inverse")
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Error("NewCholesky для неположительно определенной матрицы должен паниковать")
+        }
+    }()
+    NewCholesky(fromRows([]float64{1, 2}, []float64{2, 1}))
+}
+
+func TestSymEigen(t *testing.T) {
+    // Собственные значения трехдиагональной матрицы (2, -1): 2+√2, 2, 2-√2
+    A := fromRows([]float64{2, -1, 0}, []float64{-1, 2, -1}, []float64{0, -1, 2})
+    eig := SymEigen(A)
+    want := []float64{2 + math.Sqrt2, 2, 2 - math.Sqrt2}
+    for i, v := range want {
+        if !closeTo(eig.Values[i], v, 1e-12) {
+            t.Errorf("λ%d = %v, ожидалось %v", i, eig.Values[i], v)
+        }
+    }
+    if !reconstruct(eig.Vectors, eig.Values, eig.Vectors).Equal(A, 1e-12) {
+        t.Error("V·diag(λ)·Vᵀ != A")
+    }
+    if !Multiply(Transpose(eig.Vectors), eig.Vectors).Equal(Identity(3), 1e-12) {
+        t.Error("собственные векторы не ортонормированы")
+    }
+}
+
+func TestSVD(t *testing.T) {
+    // AᵀA = [[25 20] [20 25]]: σ² = 45 и 5
+    A := fromRows([]float64{3, 0}, []float64{4, 5})
+    svd := SVD(A)
+    if !closeTo(svd.S[0], 3*math.Sqrt(5), 1e-12) || !closeTo(svd.S[1], math.Sqrt(5), 1e-12) {
+        t.Errorf("S = %v, ожидалось [3√5 √5]", svd.S)
+    }
+
+    rng := rand.New(rand.NewSource(1))
+    // Узкая и широкая матрицы (широкая раскладывается через транспонирование)
+    for _, m := range []Matrix{A, randomMatrix(rng, 6, 4), randomMatrix(rng, 3, 5)} {
+        svd := SVD(m)
+        if !reconstruct(svd.U, svd.S, svd.V).Equal(m, 1e-12) {
+            t.Errorf("%dx%d: U·diag(S)·Vᵀ != A", m.Rows, m.Cols)
+        }
+    }
+}
+
+func TestRankAndPseudoInverse(t *testing.T) {
+    // Третий столбец - сумма первых двух: ранг 2
+    A := fromRows(
+        []float64{1, 2, 3},
+        []float64{4, 5, 9},
+        []float64{7, 8, 15},
+        []float64{1, 0, 1},
+    )
+    if r := Rank(A, 0); r != 2 {
+        t.Errorf("Rank = %d, ожидалось 2", r)
+    }
+    if r := Rank(NewMatrix(3, 2, make([]float64, 6)), 0); r != 0 {
+        t.Errorf("Rank нулевой матрицы = %d, ожидалось 0", r)
+    }
+
+    // Условия Мура-Пенроуза: A·A⁺·A = A, A⁺·A·A⁺ = A⁺
+    P := PseudoInverse(A)
+    if P.Rows != 3 || P.Cols != 4 {
+        t.Fatalf("размер A⁺ = %dx%d, ожидалось 3x4", P.Rows, P.Cols)
+    }
+    if !Multiply(Multiply(A, P), A).Equal(A, 1e-12) {
+        t.Error("A·A⁺·A != A")
+    }
+    if !Multiply(Multiply(P, A), P).Equal(P, 1e-12) {
+        t.Error("A⁺·A·A⁺ != A⁺")
+    }
+
+    // Для невырожденной матрицы A⁺ = A⁻¹
+    B := fromRows([]float64{2, 1, 1}, []float64{4, -6, 0}, []float64{-2, 7, 2})
+    if r := Rank(B, 0); r != 3 {
+        t.Errorf("Rank = %d, ожидалось 3", r)
+    }
+    if !PseudoInverse(B).Equal(Inverse(B), 1e-12) {
+        t.Error("A⁺ != A⁻¹ для невырожденной матрицы")
+    }
+}
+
+// closeTo сообщает, совпадают ли значения с относительной точностью tol
+func closeTo(got, want, tol float64) bool {
+    return math.Abs(got-want) <= tol*math.Max(1, math.Abs(want))
+}
+
+func TestNormalInv(t *testing.T) {
+    tests := []struct{ p, want float64 }{
+        {0.5, 0},
+        {0.9, 1.2815515655446004},
+        {0.975, 1.959963984540054},
+        {0.995, 2.5758293035489004},
+        {0.999, 3.090232306167813},
+        {0.025, -1.959963984540054},
+        {1e-10, -6.361340902404056},
+        {1e-20, -9.262340089798408},
+    }
+    for _, tt := range tests {
+        if got := NormalInv(tt.p); !closeTo(got, tt.want, 1e-12) {
+            t.Errorf("NormalInv(%g) = %.16g, ожидается %.16g", tt.p, got, tt.want)
+        }
+    }
+}
+
+func TestNormalCDF(t *testing.T) {
+    tests := []struct{ x, want float64 }{
+        {0, 0.5},
+        {1, 0.8413447460685429},
+        {1.959963984540054, 0.975},
+        {-1.959963984540054, 0.025},
+        {-8, 6.22096057427178e-16},
+        {-20, 2.7536241186062337e-89},
+    }
+    for _, tt := range tests {
+        if got := NormalCDF(tt.x); math.Abs(got-tt.want) > 1e-12*tt.want {
+            t.Errorf("NormalCDF(%g) = %.16g, ожидается %.16g", tt.x, got, tt.want)
+        }
+    }
+    // Обратимость в центре и хвостах
+    for _, p := range []float64{1e-300, 1e-15, 1e-5, 0.02425, 0.3, 0.7, 0.97575, 1 - 1e-9} {
+        tail := math.Min(p, 1-p)
+        if got := NormalCDF(NormalInv(p)); math.Abs(got-p) > 1e-12*tail {
+            t.Errorf("NormalCDF(NormalInv(%g)) = %.16g", p, got)
+        }
+    }
+}
+
+func TestTDistribution(t *testing.T) {
+    // Точные формулы: df = 1 - распределение Коши, df = 2 - явная функция
+    for _, p := range []float64{0.001, 0.1, 0.5, 0.9, 0.975, 0.9995} {
+        cauchy := math.Tan(math.Pi * (p - 0.5))
+        if got := tQuantile(p, 1); !closeTo(got, cauchy, 1e-12) {
+            t.Errorf("tQuantile(%g, 1) = %.16g, ожидается %.16g", p, got, cauchy)
+        }
+        df2 := (2*p - 1) / math.Sqrt(2*p*(1-p))
+        if got := tQuantile(p, 2); !closeTo(got, df2, 1e-12) {
+            t.Errorf("tQuantile(%g, 2) = %.16g, ожидается %.16g", p, got, df2)
+        }
+    }
+    for _, x := range []float64{-30, -2, -0.5, 0, 0.5, 2, 30} {
+        if got, want := TCDF(x, 1), 0.5+math.Atan(x)/math.Pi; !closeTo(got, want, 1e-12) {
+            t.Errorf("TCDF(%g, 1) = %.16g, ожидается %.16g", x, got, want)
+        }
+        if got, want := TCDF(x, 2), 0.5+x/(2*math.Sqrt(2+x*x)); !closeTo(got, want, 1e-12) {
+            t.Errorf("TCDF(%g, 2) = %.16g, ожидается %.16g", x, got, want)
+        }
+    }
+
+    // Табличные значения сохраняются, остальные df вычисляются точно
+    tests := []struct {
+        p    float64
+        df   int
+        want float64
+        tol  float64
+    }{
+        {0.975, 15, 2.131, 0},
+        {0.975, 12, 2.178812829667228, 1e-12},
+        {0.975, 40, 2.021075390306273, 1e-12},
+        {0.975, 100, 1.983971518523552, 1e-12},
+        {0.9, 12, 1.356217334023204, 1e-12},
+    }
+    for _, tt := range tests {
+        if got := TInv(tt.p, tt.df); !closeTo(got, tt.want, tt.tol) {
+            t.Errorf("TInv(%g, %d) = %.16g, ожидается %.16g", tt.p, tt.df, got, tt.want)
+        }
+    }
+}
+
+func TestFDistribution(t *testing.T) {
+    // При df1 = 2: F(f) = 1 - (1 + 2f/df2)^(-df2/2), квантиль выражается явно;
+    // df2 выбраны вне таблицы FInv
+    for _, df2 := range []int{7, 15, 60} {
+        d := float64(df2)
+        for _, f := range []float64{0.1, 1, 3.5, 20} {
+            if got, want := FCDF(f, 2, df2), 1-math.Pow(1+2*f/d, -d/2); !closeTo(got, want, 1e-12) {
+                t.Errorf("FCDF(%g, 2, %d) = %.16g, ожидается %.16g", f, df2, got, want)
+            }
+        }
+        want := d / 2 * (math.Pow(0.05, -2/d) - 1)
+        if got := FInv(0.05, 2, df2); !closeTo(got, want, 1e-12) {
+            t.Errorf("FInv(0.05, 2, %d) = %.16g, ожидается %.16g", df2, got, want)
+        }
+    }
+
+    // Критическое значение исходной модели (k-1 = 4, N-k = 15) отсутствует в таблице
+    if got := FInv(0.05, 4, 15); !closeTo(got, 3.055568275906686, 1e-9) {
+        t.Errorf("FInv(0.05, 4, 15) = %.16g, ожидается 3.0555682759", got)
+    }
+    if got := 1 - FCDF(FInv(0.05, 7, 23), 7, 23); !closeTo(got, 0.05, 1e-12) {
+        t.Errorf("1 - FCDF(FInv(0.05, 7, 23)) = %.16g, ожидается 0.05", got)
+    }
+}
+
+func TestQuantileRegressionNegativeY(t *testing.T) {
+    X, Y := sampleData()
+    negY := Scale(Y, -1)
+    opts := DefaultRegressionOptions()
+    // Медиана -Y равна минус медиане Y, поэтому коэффициенты меняют знак
+    q := QuantileRegression(X, Y, []float64{0.5}, opts)
+    negQ := QuantileRegression(X, negY, []float64{0.5}, opts)
+    for c, b := range q.B.Data {
+        if math.IsNaN(negQ.B.Data[c]) || !closeTo(negQ.B.Data[c], -b, 1e-9) {
+            t.Fatalf("коэффициент %d: %v, ожидалось %v", c, negQ.B.Data[c], -b)
+        }
+    }
+}
+
+func TestChowTestConsistency(t *testing.T) {
+    X, Y := sampleData()
+    for _, chow := range ChowTests(X, Y, nil, DefaultRegressionOptions()) {
+        if chow.Shift != (chow.F > chow.FCritical) || chow.Shift != (chow.PValue < 0.05) {
+            t.Errorf("сдвиг с %d: F = %v, Fкрит = %v, p = %v, Shift = %t", chow.Break, chow.F, chow.FCritical, chow.PValue, chow.Shift)
+        }
+        if got := 1 - FCDF(chow.FCritical, chow.DF1, chow.DF2); !closeTo(got, 0.05, 1e-12) {
+            t.Errorf("сдвиг с %d: уровень критического значения %v", chow.Break, got)
+        }
+    }
+
+    // Ступенчатый сдвиг уровня потребления во второй половине выборки обнаруживается
+    shifted := Y.Clone()
+    for i := 10; i < shifted.Rows; i++ {
+        shifted.Data[i] += 3000
+    }
+    if chow := ChowTest(X, shifted, 10, DefaultRegressionOptions()); !chow.Shift || chow.PValue >= 0.05 {
+        t.Errorf("сдвиг уровня не обнаружен: %+v", chow)
+    }
+}
+
+func TestForecastIntervalMethods(t *testing.T) {
+    X, Y := sampleData()
+    x := NewMatrix(1, 2, []float64{21, 21.3})
+    xi := Augment(x).Row(0)
+
+    // t-метод: доверительный интервал среднего ŷ ± t·√(xᵢ(XᵀX)⁻¹xᵢᵀ·σ²)
+    result := RunRegression(X, Y)
+    forecast := NewModel(result).Predict(x)[0]
+    halfWidth := TInv(0.975, result.DF) * math.Sqrt(QuadForm(xi, result.G)*result.Dad)
+    if !closeTo(forecast.High-forecast.Y, halfWidth, 1e-12) || !closeTo(forecast.Y-forecast.Low, halfWidth, 1e-12) {
+        t.Errorf("интервал t-метода [%v; %v] вокруг %v, ожидается ±%v", forecast.Low, forecast.High, forecast.Y, halfWidth)
+    }
+
+    // Бутстреп вне выборки дает интервал прогноза нового наблюдения (с ошибкой e*),
+    // а на обучающей выборке - более узкий доверительный интервал среднего
+    for _, interval := range []string{IntervalResidualBootstrap, IntervalPairsBootstrap} {
+        opts := DefaultRegressionOptions()
+        opts.Interval = interval
+        bootstrap := RunRegressionWithOptions(X, Y, opts)
+        f := NewModel(bootstrap).Predict(x)[0]
+        if f.High-f.Low <= 2*halfWidth {
+            t.Errorf("%s: интервал прогноза %v не шире доверительного интервала среднего %v", interval, f.High-f.Low, 2*halfWidth)
+        }
+        last := len(bootstrap.YR) - 1
+        if confWidth := bootstrap.YConfHigh[last] - bootstrap.YConfLow[last]; confWidth >= f.High-f.Low {
+            t.Errorf("%s: доверительный интервал среднего %v не уже интервала прогноза %v", interval, confWidth, f.High-f.Low)
+        }
+    }
+}
+
+func TestRollingCancellationSkipsRefit(t *testing.T) {
+    X, Y := sampleData()
+    // Окно из трех наблюдений вырождено: любое переобучение вызвало бы панику
+    forecaster := NewForecaster(X.RowsView(0, 3), Y.RowsView(0, 3), DefaultRegressionOptions())
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    result, err := rollForecaster(ctx, forecaster, X.RowsView(3, 6), Y.RowsView(3, 6), 4)
+    if !errors.Is(err, context.Canceled) {
+        t.Fatalf("ошибка %v, ожидалась context.Canceled", err)
+    }
+    if forecaster.result != nil {
+        t.Error("отмененный прогноз не должен переобучать модель")
+    }
+    if len(result.Predictions) != 0 || len(result.Terms) != 5 {
+        t.Errorf("прогнозов %d, членов %d; ожидалось 0 и 5", len(result.Predictions), len(result.Terms))
+    }
+}
+
+func TestEvaluateIntervals(t *testing.T) {
+    // Интервалы ±z при z = Φ⁻¹(0.975) дают σ = 1; факты 0 и 1 внутри, 3 - выше
+    z := NormalInv(0.975)
+    result := PredictionResult{
+        Predictions:     []float64{0, 0, 0},
+        PredictionsLow:  []float64{-z, -z, -z},
+        PredictionsHigh: []float64{z, z, z},
+        Actuals:         []float64{0, 1, 3},
+        Confidence:      0.95,
+    }
+    evaluation := EvaluateIntervals(result, 10)
+    if !closeTo(evaluation.Coverage, 2.0/3, 1e-12) {
+        t.Errorf("Coverage = %v, ожидалось 2/3", evaluation.Coverage)
+    }
+    if !closeTo(evaluation.MeanWidth, 2*z, 1e-12) {
+        t.Errorf("MeanWidth = %v, ожидалось %v", evaluation.MeanWidth, 2*z)
+    }
+    // Винклер: (2z + 2z + 2z + 2/0.05·(3 - z)) / 3
+    if !closeTo(evaluation.WinklerScore, 17.787074841879388, 1e-12) {
+        t.Errorf("WinklerScore = %v, ожидалось 17.787074841879388", evaluation.WinklerScore)
+    }
+    // CRPS стандартного нормального распределения при u = 0, 1, 3
+    if !closeTo(evaluation.CRPS, 1.090903686656355, 1e-12) {
+        t.Errorf("CRPS = %v, ожидалось 1.090903686656355", evaluation.CRPS)
+    }
+    wantPIT := []float64{0.5, 0.8413447460685429, 0.9986501019683699}
+    for i, want := range wantPIT {
+        if !closeTo(evaluation.PIT[i], want, 1e-12) {
+            t.Errorf("PIT[%d] = %v, ожидалось %v", i, evaluation.PIT[i], want)
+        }
+    }
+    wantHistogram := []int{0, 0, 0, 0, 0, 1, 0, 0, 1, 1}
+    for i, want := range wantHistogram {
+        if evaluation.PITHistogram[i] != want {
+            t.Fatalf("PITHistogram = %v, ожидалось %v", evaluation.PITHistogram, wantHistogram)
+        }
+    }
+}
+
+func TestEvaluateIntervalsZeroWidth(t *testing.T) {
+    // Вырожденные интервалы Low = High: точечная масса в прогнозе
+    result := PredictionResult{
+        Predictions:     []float64{10, 10, 10},
+        PredictionsLow:  []float64{10, 10, 10},
+        PredictionsHigh: []float64{10, 10, 10},
+        Actuals:         []float64{8, 10, 13},
+        Confidence:      0.95,
+    }
+    evaluation := EvaluateIntervals(result, 4)
+    if !closeTo(evaluation.CRPS, 5.0/3, 1e-12) {
+        t.Errorf("CRPS = %v, ожидалось среднее |y - ŷ| = 5/3", evaluation.CRPS)
+    }
+    if evaluation.PIT[0] != 0 || evaluation.PIT[1] != 1 || evaluation.PIT[2] != 1 {
+        t.Errorf("PIT = %v, ожидалось [0 1 1]", evaluation.PIT)
+    }
+    if h := evaluation.PITHistogram; h[0] != 1 || h[3] != 2 {
+        t.Errorf("PITHistogram = %v, ожидалось [1 0 0 2]", h)
+    }
+    if evaluation.MeanWidth != 0 || !closeTo(evaluation.Coverage, 1.0/3, 1e-12) {
+        t.Errorf("MeanWidth = %v, Coverage = %v", evaluation.MeanWidth, evaluation.Coverage)
+    }
+}
+
+func TestSandwichCovariance(t *testing.T) {
+    X, Y := sampleData()
+    result := RunRegression(X, Y)
+    A := Augment(X)
+    n, k := A.Rows, A.Cols
+    residuals := make([]float64, n)
+    for i := range residuals {
+        residuals[i] = Y.At(i, 0) - result.YR[i]
+    }
+
+    // HC0 вручную: G·Xᵀdiag(e²)X·G
+    weighted := A.Clone()
+    for i := 0; i < n; i++ {
+        for j := 0; j < k; j++ {
+            weighted.Set(i, j, residuals[i]*residuals[i]*A.At(i, j))
+        }
+    }
+    want := Multiply(Multiply(result.G, Multiply(Transpose(A), weighted)), result.G)
+    hc0 := SandwichCovariance(A, residuals, result.G, CovarianceHC0, 0)
+    for i, v := range want.Data {
+        if !closeTo(hc0.Data[i], v, 1e-9) {
+            t.Fatalf("HC0[%d] = %v, ожидалось %v", i, hc0.Data[i], v)
+        }
+    }
+    hc1 := SandwichCovariance(A, residuals, result.G, CovarianceHC1, 0)
+    for i, v := range hc0.Data {
+        if !closeTo(hc1.Data[i], v*float64(n)/float64(n-k), 1e-9) {
+            t.Fatalf("HC1[%d] = %v, ожидалось HC0·n/(n-k) = %v", i, hc1.Data[i], v*float64(n)/float64(n-k))
+        }
+    }
+
+    // Ньюи-Уэст с одним лагом: HC0 плюс член Бартлетта с весом 1/2
+    // G·(½Σ eₜeₜ₋₁(xₜxₜ₋₁ᵀ + xₜ₋₁xₜᵀ))·G
+    cross := NewMatrix(k, k, make([]float64, k*k))
+    for r := 1; r < n; r++ {
+        c := 0.5 * residuals[r] * residuals[r-1]
+        for a := 0; a < k; a++ {
+            for b := 0; b < k; b++ {
+                cross.Data[a*k+b] += c * (A.At(r, a)*A.At(r-1, b) + A.At(r-1, a)*A.At(r, b))
+            }
+        }
+    }
+    want = Add(hc0, Multiply(Multiply(result.G, cross), result.G))
+    nw := SandwichCovariance(A, residuals, result.G, CovarianceNeweyWest, 1)
+    for i, v := range want.Data {
+        if !closeTo(nw.Data[i], v, 1e-9) {
+            t.Fatalf("Ньюи-Уэст[%d] = %v, ожидалось %v", i, nw.Data[i], v)
+        }
+    }
+}
+
+func TestSandwichCovarianceFullLeverage(t *testing.T) {
+    // Индикатор единственного наблюдения дает ему рычаг h = 1 и нулевой остаток
+    A := fromRows(
+        []float64{1, 1},
+        []float64{1, 0},
+        []float64{1, 0},
+        []float64{1, 0},
+        []float64{1, 0},
+    )
+    Y := fromRows([]float64{5}, []float64{1}, []float64{2}, []float64{4}, []float64{3})
+    G := Inverse(Multiply(Transpose(A), A))
+    B := Multiply(G, Multiply(Transpose(A), Y))
+    residuals := Sub(Y, Multiply(A, B)).Data
+    for _, kind := range []string{CovarianceHC2, CovarianceHC3} {
+        cov := SandwichCovariance(A, residuals, G, kind, 0)
+        for i, v := range cov.Data {
+            if math.IsNaN(v) || math.IsInf(v, 0) {
+                t.Fatalf("%s: элемент %d ковариации = %v", kind, i, v)
+            }
+        }
+    }
+}
+
+func TestAR1ErrorsRecoverRho(t *testing.T) {
+    // Модель Augment с AR(1)-ошибками eₜ = 0.7eₜ₋₁ + uₜ
+    const n, rho = 300, 0.7
+    rng := rand.New(rand.NewSource(7))
+    X := NewMatrix(n, 2, make([]float64, 2*n))
+    Y := NewMatrix(n, 1, make([]float64, n))
+    b := []float64{3000, 2, 0.01, -40, 0.1}
+    e := 0.0
+    for i := 0; i < n; i++ {
+        X.Set(i, 0, float64(i+1))
+        X.Set(i, 1, 20+5*rng.NormFloat64())
+        e = rho*e + 50*rng.NormFloat64()
+        Y.Set(i, 0, Dot(Augment(X.RowsView(i, i+1)).Row(0), b)+e)
+    }
+
+    ols := RunRegression(X, Y)
+    for _, estimator := range []string{EstimatorCochraneOrcutt, EstimatorPraisWinsten} {
+        opts := DefaultRegressionOptions()
+        opts.Estimator = estimator
+        result := RunRegressionWithOptions(X, Y, opts)
+        if math.Abs(result.Rho-rho) > 0.1 {
+            t.Errorf("%s: ρ = %v, ожидалось около %v", estimator, result.Rho, rho)
+        }
+        // Кокрейн-Оркатт отбрасывает первое наблюдение, Прайс-Уинстен - нет
+        wantDF := ols.DF
+        if estimator == EstimatorCochraneOrcutt {
+            wantDF--
+        }
+        if result.DF != wantDF {
+            t.Errorf("%s: DF = %d, ожидалось %d", estimator, result.DF, wantDF)
+        }
+    }
+}
+
+func TestForecasterSnapshotRestore(t *testing.T) {
+    X, Y := sampleData()
+    f := NewForecaster(X.RowsView(0, 15), Y.RowsView(0, 15), DefaultRegressionOptions())
+    for i := 15; i < 18; i++ {
+        f.Observe(X.Row(i), Y.At(i, 0))
+    }
+    x := []float64{21, 21.3}
+    want := f.Predict(x)
+
+    // Восстановление из снимка, в том числе после JSON, дает тот же прогноз
+    state := f.Snapshot()
+    data, err := json.Marshal(state)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded ForecasterState
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+    for _, s := range []ForecasterState{state, decoded} {
+        restored := &Forecaster{}
+        restored.Restore(s)
+        if got := restored.Predict(x); got != want {
+            t.Errorf("прогноз после Restore %+v, ожидалось %+v", got, want)
+        }
+    }
+
+    // Снимок - копия: его изменение и работа восстановленного прогнозиста
+    // не затрагивают исходный
+    restored := &Forecaster{}
+    restored.Restore(state)
+    state.X.Data[0] = 1000
+    state.Y.Data[0] = -1000
+    restored.Observe(X.Row(18), Y.At(18, 0))
+    if got := f.Predict(x); got != want {
+        t.Errorf("прогноз изменился после правки снимка: %+v, ожидалось %+v", got, want)
+    }
+    if windowX, _ := f.Window(); windowX.At(0, 0) != 4 {
+        t.Errorf("окно начинается с дня %v, ожидался день 4", windowX.At(0, 0))
+    }
+}
+
+// batchSeries возвращает n независимых рядов с разным масштабом потребления;
+// ряд с индексом bad получает вырожденное окно из трех дней
+func batchSeries(n, bad int) []Series {
+    X, Y := sampleData()
+    series := make([]Series, n)
+    for i := range series {
+        scaled := Scale(Y, 1+0.1*float64(i))
+        series[i] = Series{
+            ID:          fmt.Sprintf("фидер-%d", i),
+            InitialX:    X.RowsView(0, 15),
+            InitialY:    scaled.RowsView(0, 15),
+            AdditionalX: X.RowsView(15, 20),
+            AdditionalY: scaled.RowsView(15, 20),
+            WindowSize:  15,
+        }
+        if i%2 == 1 {
+            series[i].Options.Interval = IntervalResidualBootstrap
+            series[i].Options.Resamples = 99
+        }
+    }
+    series[bad].InitialX, series[bad].InitialY = X.RowsView(0, 3), Y.RowsView(0, 3)
+    return series
+}
+
+// Запускайте с -race: ряды рассчитываются параллельно без общего состояния
+func TestRunBatchConcurrent(t *testing.T) {
+    series := batchSeries(10, 3)
+    results := RunBatch(context.Background(), series, 4)
+    if len(results) != len(series) {
+        t.Fatalf("%d результатов вместо %d", len(results), len(series))
+    }
+    for i, r := range results {
+        if r.ID != series[i].ID {
+            t.Errorf("результат %d относится к ряду %s, ожидался %s", i, r.ID, series[i].ID)
+        }
+        if i == 3 {
+            if r.Err == nil {
+                t.Error("ряд с вырожденным окном должен вернуть ошибку")
+            }
+            continue
+        }
+        if r.Err != nil {
+            t.Errorf("ряд %s: %v", r.ID, r.Err)
+            continue
+        }
+        // Параллельный расчет совпадает с последовательным
+        want := runSeries(context.Background(), series[i])
+        for j, y := range want.Prediction.Predictions {
+            if r.Prediction.Predictions[j] != y || r.Prediction.PredictionsLow[j] != want.Prediction.PredictionsLow[j] {
+                t.Errorf("ряд %s, день %d: параллельный прогноз расходится с последовательным", r.ID, j)
+            }
+        }
+    }
+}
+
+func TestRunBatchCancelled(t *testing.T) {
+    series := batchSeries(8, 0)
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    for i, r := range RunBatch(ctx, series, 4) {
+        if r.ID != series[i].ID || !errors.Is(r.Err, context.Canceled) {
+            t.Errorf("ряд %d: ID %q, ошибка %v; ожидалась context.Canceled", i, r.ID, r.Err)
+        }
+    }
+}
+
+// levelShiftData возвращает n дней потребления, линейно зависящего от температуры,
+// со сдвигом уровня на shift начиная с дня shiftDay
+func levelShiftData(n, shiftDay int, shift float64) (Matrix, Matrix) {
+    rng := rand.New(rand.NewSource(3))
+    X := NewMatrix(n, 2, make([]float64, 2*n))
+    Y := NewMatrix(n, 1, make([]float64, n))
+    for i := 0; i < n; i++ {
+        day, temp := float64(i+1), 20+4*rng.NormFloat64()
+        X.Set(i, 0, day)
+        X.Set(i, 1, temp)
+        y := 3000 + 5*day + 40*temp + 20*rng.NormFloat64()
+        if i+1 >= shiftDay {
+            y += shift
+        }
+        Y.Set(i, 0, y)
+    }
+    return X, Y
+}
+
+func TestChangeDetector(t *testing.T) {
+    // Ошибки ±2σ при δ = 0.5 накапливают по 1.5 за шаг: порог 5 превышается на 4-м шаге
+    for _, method := range []string{DetectorPageHinkley, DetectorCUSUM} {
+        for _, z := range []float64{2, -2} {
+            d := ChangeDetector{Method: method}
+            for step := 1; step <= 4; step++ {
+                if detected := d.Update(z); detected != (step == 4) {
+                    t.Errorf("%s, z = %v: сигнал на шаге %d = %v", method, z, step, detected)
+                }
+            }
+            if d.Up != 0 || d.Down != 0 {
+                t.Errorf("%s: статистики не сброшены после сигнала: %+v", method, d)
+            }
+        }
+    }
+}
+
+func TestAdaptiveWindowLevelShift(t *testing.T) {
+    // Окно 20 дней, прогноз дней 21-60, сдвиг уровня на 75σ с дня 31
+    X, Y := levelShiftData(60, 31, 1500)
+    adaptive := AdaptiveWindow{MinSize: 10, MaxSize: 20, Detector: ChangeDetector{Method: DetectorCUSUM, Delta: 1, Threshold: 10}}
+    result, err := AdaptiveWindowPrediction(context.Background(), X.RowsView(0, 20), Y.RowsView(0, 20), X.RowsView(20, 60), Y.RowsView(20, 60), adaptive, DefaultRegressionOptions())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result.WindowSizes) != 40 || len(result.ChangePoints) == 0 {
+        t.Fatalf("длины окна %v, смены режима %v", result.WindowSizes, result.ChangePoints)
+    }
+    if result.ChangePoints[0] != 31 {
+        t.Errorf("первая смена режима после дня %d, ожидался день 31", result.ChangePoints[0])
+    }
+
+    // После сигнала окно сокращается до MinSize, затем растет на строку за шаг до MaxSize
+    changed := make(map[int]bool)
+    for _, day := range result.ChangePoints {
+        changed[day] = true
+    }
+    if result.WindowSizes[0] != 20 {
+        t.Errorf("начальная длина окна %d, ожидалось 20", result.WindowSizes[0])
+    }
+    for i := 1; i < len(result.WindowSizes); i++ {
+        want := min(result.WindowSizes[i-1]+1, adaptive.MaxSize)
+        if changed[result.Days[i-1]] {
+            want = adaptive.MinSize
+        }
+        if result.WindowSizes[i] != want {
+            t.Fatalf("день %d: длина окна %d, ожидалось %d (%v)", result.Days[i], result.WindowSizes[i], want, result.WindowSizes)
+        }
+    }
+    if last := result.WindowSizes[len(result.WindowSizes)-1]; last != adaptive.MaxSize {
+        t.Errorf("окно не восстановилось до MaxSize: %d", last)
+    }
+}
+
+// relClose сообщает, совпадают ли срезы поэлементно с относительной точностью tol
+func relClose(got, want []float64, tol float64) bool {
+    if len(got) != len(want) {
+        return false
+    }
+    for i := range want {
+        if math.Abs(got[i]-want[i]) > tol*math.Abs(want[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+func TestStandardizeMatchesOriginalScale(t *testing.T) {
+    X, Y := sampleData()
+    plain := RunRegression(X, Y)
+    opts := DefaultRegressionOptions()
+    opts.Standardize = true
+    standardized := RunRegressionWithOptions(X, Y, opts)
+    if !relClose(standardized.B.Data, plain.B.Data, 1e-10) {
+        t.Errorf("B = %v, ожидалось %v", standardized.B.Data, plain.B.Data)
+    }
+    if !relClose(standardized.G.Data, plain.G.Data, 1e-10) {
+        t.Errorf("G со стандартизацией расходится с (XᵀX)⁻¹")
+    }
+    if !relClose(standardized.SE, plain.SE, 1e-10) {
+        t.Errorf("SE = %v, ожидалось %v", standardized.SE, plain.SE)
+    }
+
+    // Без свободного члена столбцы только масштабируются
+    A := Augment(X).Slice(0, X.Rows, 1, 5)
+    B, G := fitLeastSquares(A, Y, false)
+    BZ, GZ := fitLeastSquares(A, Y, true)
+    if !relClose(BZ.Data, B.Data, 1e-10) || !relClose(GZ.Data, G.Data, 1e-10) {
+        t.Errorf("без свободного члена: B = %v, ожидалось %v", BZ.Data, B.Data)
+    }
+}
+
+func TestCollinearity(t *testing.T) {
+    // Две переменные с корреляцией 0.8: VIF = 1/(1 - 0.64)
+    X := fromRows(
+        []float64{1, 1, 1},
+        []float64{1, 2, 3},
+        []float64{1, 3, 2},
+        []float64{1, 4, 4},
+    )
+    d := Collinearity(X, []string{"1", "x", "z"})
+    want := []float64{0, 1 / (1 - 0.64), 1 / (1 - 0.64)}
+    for j, v := range want {
+        if !closeTo(d.VIF[j], v, 1e-12) {
+            t.Errorf("VIF[%d] = %v, ожидалось %v", j, d.VIF[j], v)
+        }
+    }
+    // Доли дисперсии каждого коэффициента в сумме дают 1
+    for j := 0; j < X.Cols; j++ {
+        total := 0.0
+        for k := 0; k < X.Cols; k++ {
+            total += d.VarianceProportions.At(k, j)
+        }
+        if !closeTo(total, 1, 1e-12) {
+            t.Errorf("сумма долей дисперсии коэффициента %d = %v", j, total)
+        }
+    }
+
+    // Ортогональные столбцы равной длины: все индексы обусловленности равны 1
+    orthogonal := fromRows(
+        []float64{1, 1, 1},
+        []float64{1, -1, 1},
+        []float64{1, 1, -1},
+        []float64{1, -1, -1},
+    )
+    d = Collinearity(orthogonal, []string{"1", "a", "b"})
+    for k, eta := range d.ConditionIndices {
+        if !closeTo(eta, 1, 1e-12) {
+            t.Errorf("индекс обусловленности %d = %v, ожидалось 1", k, eta)
+        }
+    }
+    if len(d.Warnings()) != 0 {
+        t.Errorf("предупреждения для ортогонального плана: %v", d.Warnings())
+    }
+}
+
+func TestCollinearityWarnings(t *testing.T) {
+    X, Y := sampleData()
+    // В плане Augment X1 сильно коррелирует с X1² и X1*X3
+    result := RunRegression(X, Y)
+    vif := result.Collinearity.VIF
+    if vif[1] <= VIFThreshold || vif[2] <= VIFThreshold {
+        t.Errorf("VIF(X1) = %v, VIF(X1^2) = %v, ожидалось больше %v", vif[1], vif[2], VIFThreshold)
+    }
+    found := false
+    for _, w := range result.Warnings {
+        if strings.HasPrefix(w, "VIF(X1) =") {
+            found = true
+        }
+    }
+    if !found {
+        t.Errorf("нет предупреждения о VIF(X1): %v", result.Warnings)
+    }
+
+    // Центрирование дня и температуры устраняет мультиколлинеарность
+    opts := DefaultRegressionOptions()
+    opts.Design.Center = true
+    if centered := RunRegressionWithOptions(X, Y, opts); len(centered.Warnings) != 0 {
+        t.Errorf("предупреждения после центрирования: %v", centered.Warnings)
+    }
+}
+
+func TestCalendarFeatures(t *testing.T) {
+    dir := t.TempDir()
+    path := dir + "/holidays.txt"
+    if err := os.WriteFile(path, []byte("2024-01-01 Новый год\n2024-01-07 Рождество\n"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    holidays, err := LoadHolidays(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(holidays) != 2 || holidays[0] != "2024-01-01" || holidays[1] != "2024-01-07" {
+        t.Fatalf("праздники %v", holidays)
+    }
+
+    // 1 января 2024 - понедельник (базовая категория); столбцы Вт..Вс, Праздник
+    c := CalendarFeatures{StartDate: "2024-01-01", DayOfWeek: true, Holidays: holidays}
+    features := c.Features([]float64{1, 2, 6, 7, 8})
+    want := [][]float64{
+        {0, 0, 0, 0, 0, 0, 1},
+        {1, 0, 0, 0, 0, 0, 0},
+        {0, 0, 0, 0, 1, 0, 0},
+        {0, 0, 0, 0, 0, 1, 1},
+        {0, 0, 0, 0, 0, 0, 0},
+    }
+    if !features.Equal(fromRows(want...), 0) {
+        t.Errorf("календарные признаки %v, ожидалось %v", matrixRows(features), want)
+    }
+
+    malformed := dir + "/malformed.txt"
+    if err := os.WriteFile(malformed, []byte("# праздники\n2024-01-01\n2024-13-01 ошибка\n"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := LoadHolidays(malformed); err == nil || !strings.Contains(err.Error(), ":3:") {
+        t.Errorf("ошибка для неверной даты в строке 3: %v", err)
+    }
+}
+
+func TestTemperatureFeatures(t *testing.T) {
+    tf := TemperatureFeatures{HDD: true, HeatingBase: 18, CDD: true, CoolingBase: 22, Knots: []float64{20}}
+    if names := tf.Names(); len(names) != 3 || names[0] != "HDD(18)" || names[1] != "CDD(22)" || names[2] != "max(0,X3-20)" {
+        t.Errorf("названия %v", names)
+    }
+    // На базовых температурах градусо-дни равны нулю
+    features := tf.Features([]float64{15, 18, 20, 22, 25})
+    want := [][]float64{
+        {3, 0, 0},
+        {0, 0, 0},
+        {0, 0, 0},
+        {0, 0, 2},
+        {0, 3, 5},
+    }
+    if !features.Equal(fromRows(want...), 0) {
+        t.Errorf("температурные признаки %v, ожидалось %v", matrixRows(features), want)
+    }
+}
+
+func TestEstimateBalancePoint(t *testing.T) {
+    // Потребление растет на 80 за градус выше температуры баланса 21 °C
+    const n, balance = 40, 21.0
+    rng := rand.New(rand.NewSource(5))
+    X := NewMatrix(n, 2, make([]float64, 2*n))
+    Y := NewMatrix(n, 1, make([]float64, n))
+    for i := 0; i < n; i++ {
+        temp := 12 + 16*float64(i%10)/9 + rng.Float64()
+        X.Set(i, 0, float64(i+1))
+        X.Set(i, 1, temp)
+        Y.Set(i, 0, 3000+5*float64(i+1)+10*temp+80*math.Max(0, temp-balance)+rng.NormFloat64())
+    }
+    result := EstimateBalancePoint(X, Y, DefaultRegressionOptions(), nil)
+    if math.Abs(result.Temperature-balance) > 0.3 {
+        t.Errorf("температура баланса %v, ожидалось %v", result.Temperature, balance)
+    }
+    if terms := result.Result.Design.Terms; terms[len(terms)-1] != fmt.Sprintf("max(0,X3-%g)", result.Temperature) {
+        t.Errorf("модель не содержит излома в найденной точке: %v", terms)
+    }
+}
+
+func TestLagFeatures(t *testing.T) {
+    X, Y := sampleData()
+    design := Design{Name: DesignPoly2, Lags: &LagFeatures{Y: []int{1}, X3: []int{2}}}
+    laggedX, laggedY := design.Lagged(X, Y)
+    // Первые два дня - только предыстория: строка i соответствует дню i+3
+    if laggedX.Rows != 18 || laggedY.Rows != 18 {
+        t.Fatalf("после лагов %d строк, ожидалось 18", laggedX.Rows)
+    }
+    for i := 0; i < laggedX.Rows; i++ {
+        want := []float64{X.At(i+2, 0), X.At(i+2, 1), Y.At(i+1, 0), X.At(i, 1)}
+        if got := laggedX.Row(i); !relClose(got, want, 0) || laggedY.At(i, 0) != Y.At(i+2, 0) {
+            t.Fatalf("строка %d: %v, ожидалось %v", i, got, want)
+        }
+    }
+}
+
+func TestForecasterLags(t *testing.T) {
+    X, Y := sampleData()
+    opts := DefaultRegressionOptions()
+    opts.Design.Lags = &LagFeatures{Y: []int{1}}
+    f := NewForecaster(X.RowsView(0, 15), Y.RowsView(0, 15), opts)
+
+    // После сдвига окна лаг берется из последнего наблюдения окна (день 16)
+    f.Observe(X.Row(15), Y.At(15, 0))
+    model := f.Model()
+    x21, x22 := []float64{21, 21.3}, []float64{22, 23}
+    forecasts := f.PredictAhead([][]float64{x21, x22})
+    step1 := model.Predict(NewMatrix(1, 3, []float64{21, 21.3, Y.At(15, 0)}))[0]
+    if forecasts[0] != step1 {
+        t.Errorf("шаг 1: %+v, ожидалось %+v", forecasts[0], step1)
+    }
+    if got := f.Predict(x21); got != step1 {
+        t.Errorf("Predict: %+v, ожидалось %+v", got, step1)
+    }
+
+    // На шаге 2 значением Y(t-1) служит прогноз шага 1
+    step2 := model.predictAhead(NewMatrix(1, 3, []float64{22, 23, step1.Y}), 2)[0]
+    if forecasts[1] != step2 {
+        t.Errorf("шаг 2: %+v, ожидалось %+v", forecasts[1], step2)
+    }
+}
+
+func TestBaselineNaive(t *testing.T) {
+    _, Y := sampleData()
+    all := Y.Data
+    for _, tc := range []struct {
+        method string
+        lag    int
+    }{
+        {BaselineNaive, 1},
+        {BaselineSeasonalNaive, 7},
+    } {
+        // Окно 14 дней, прогноз дней 15-20: прогноз дня t - факт дня t-lag
+        result, err := RollingBaselinePrediction(context.Background(), Y.RowsView(0, 14), Y.RowsView(14, 20), 14, Baseline{Method: tc.method})
+        if err != nil {
+            t.Fatal(err)
+        }
+        for i, got := range result.Predictions {
+            if want := all[14+i-tc.lag]; got != want {
+                t.Errorf("%s, день %d: прогноз %v, ожидалось %v", tc.method, result.Days[i], got, want)
+            }
+        }
+    }
+}
+
+func TestDieboldMariano(t *testing.T) {
+    // Ошибки 1, 2, 1, 2 против 1, 1, 1, 1: разности квадратов потерь d = 0, 3, 0, 3,
+    // d̄ = 1.5, γ₀ = 2.25, DM = 1.5/√(2.25/4) = 2
+    first := PredictionResult{Actuals: []float64{0, 0, 0, 0}, Predictions: []float64{1, 2, 1, 2}}
+    second := PredictionResult{Actuals: []float64{0, 0, 0, 0}, Predictions: []float64{1, 1, 1, 1}}
+    dm := DieboldMariano(first, second, LossSquared, 1)
+    if !closeTo(dm.MeanDifference, 1.5, 1e-12) || !closeTo(dm.Statistic, 2, 1e-12) {
+        t.Errorf("d̄ = %v, DM = %v; ожидалось 1.5 и 2", dm.MeanDifference, dm.Statistic)
+    }
+    if !closeTo(dm.PValueNormal, 0.04550026389635842, 1e-12) {
+        t.Errorf("p-value N(0, 1) = %v", dm.PValueNormal)
+    }
+    // HLN = 2·√((n + 1 - 2h + h(h-1)/n)/n) = √3; p-value t(3): 1/2 - 1/π
+    if !closeTo(dm.HLN, math.Sqrt(3), 1e-12) || !closeTo(dm.PValue, 0.5-1/math.Pi, 1e-12) {
+        t.Errorf("HLN = %v, p = %v; ожидалось √3 и 1/2 - 1/π", dm.HLN, dm.PValue)
+    }
+
+    // h = 2: отрицательная оценка дисперсии заменяется γ₀, HLN = 2·√(1.5/4)
+    dm = DieboldMariano(first, second, LossSquared, 2)
+    if !closeTo(dm.Statistic, 2, 1e-12) || !closeTo(dm.HLN, 2*math.Sqrt(1.5/4), 1e-12) {
+        t.Errorf("h = 2: DM = %v, HLN = %v", dm.Statistic, dm.HLN)
+    }
+
+    // Одинаковые ошибки: разности потерь нулевые, статистика 0 вместо 0/0
+    dm = DieboldMariano(first, first, LossAbsolute, 1)
+    if dm.Statistic != 0 || dm.HLN != 0 || dm.PValue != 1 || dm.PValueNormal != 1 {
+        t.Errorf("одинаковые прогнозы: %+v", dm)
+    }
+}
+
+func TestSaveHistory(t *testing.T) {
+    X, Y := sampleData()
+    result := RollingWindowPrediction(X.RowsView(0, 15), Y.RowsView(0, 15), X.RowsView(15, 20), Y.RowsView(15, 20), 15)
+    if len(result.History) != 5 {
+        t.Fatalf("история из %d шагов, ожидалось 5", len(result.History))
+    }
+    dir := t.TempDir()
+
+    // CSV: заголовок, затем по строке на шаг; B и SE - по столбцу на член модели
+    if err := SaveHistory(dir+"/history.csv", result); err != nil {
+        t.Fatal(err)
+    }
+    file, err := os.Open(dir + "/history.csv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    records, err := csv.NewReader(file).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    wantHeader := []string{"day", "window_start", "window_end",
+        "B[1]", "B[X1]", "B[X1^2]", "B[X3]", "B[X1*X3]",
+        "SE[1]", "SE[X1]", "SE[X1^2]", "SE[X3]", "SE[X1*X3]",
+        "dad", "f", "f_critical", "decision", "correlation"}
+    if !reflect.DeepEqual(records[0], wantHeader) {
+        t.Errorf("заголовок CSV %v, ожидалось %v", records[0], wantHeader)
+    }
+    if len(records) != len(result.History)+1 {
+        t.Fatalf("%d строк данных CSV, ожидалось %d", len(records)-1, len(result.History))
+    }
+    for i, step := range result.History {
+        record := records[i+1]
+        b, err := strconv.ParseFloat(record[3], 64)
+        if record[0] != strconv.Itoa(step.Day) || err != nil || b != step.B[0] || record[16] != step.Decision {
+            t.Errorf("строка CSV %d: %v, шаг %+v", i+1, record, step)
+        }
+    }
+
+    // JSON: названия членов и шаги восстанавливаются без потерь
+    if err := SaveHistory(dir+"/history.json", result); err != nil {
+        t.Fatal(err)
+    }
+    data, err := os.ReadFile(dir + "/history.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded struct {
+        Terms   []string    `json:"terms"`
+        History []ModelStep `json:"history"`
+    }
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(decoded.Terms, result.Terms) || !reflect.DeepEqual(decoded.History, result.History) {
+        t.Errorf("история после JSON %+v, ожидалось %+v", decoded, result.History)
+    }
+
+    if err := SaveHistory(dir+"/missing/history.csv", result); err == nil {
+        t.Error("запись в несуществующий каталог должна вернуть ошибку")
+    }
+}
+
+func TestEnsembleCancellation(t *testing.T) {
+    X, Y := sampleData()
+    members := []EnsembleMember{{Name: "10", WindowSize: 10}, {Name: "20", WindowSize: 20}}
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err := EnsemblePrediction(ctx, X.RowsView(0, 15), Y.RowsView(0, 15), X.RowsView(15, 20), Y.RowsView(15, 20), members, CombineEqual)
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("ошибка отмененного ансамбля %v не распознается как context.Canceled", err)
+    }
+
+    // Ошибка вычислений участника возвращается как ошибка, а не паника
+    members = append(members, EnsembleMember{Name: "3", WindowSize: 3})
+    if _, err := EnsemblePrediction(context.Background(), X.RowsView(0, 15), Y.RowsView(0, 15), X.RowsView(15, 20), Y.RowsView(15, 20), members, CombineEqual); err == nil {
+        t.Error("ансамбль с вырожденным окном должен вернуть ошибку")
+    }
+}